@@ -0,0 +1,158 @@
+package collection
+
+import (
+	"github.com/aidenliu/goutil"
+	"sort"
+)
+
+// Contains 值是否在 slice 中
+func Contains[T comparable](s []T, value T) bool {
+	return IndexOf(s, value) >= 0
+}
+
+// IndexOf 值在 slice 中第一次出现的位置，不存在时返回 -1
+func IndexOf[T comparable](s []T, value T) int {
+	for i, v := range s {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// Unique 去重，保留第一次出现的顺序
+func Unique[T comparable](s []T) []T {
+	seen := make(map[T]struct{}, len(s))
+	result := make([]T, 0, len(s))
+	for _, v := range s {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		result = append(result, v)
+	}
+	return result
+}
+
+// Filter 保留 fn 返回 true 的元素
+func Filter[T any](s []T, fn func(T) bool) []T {
+	result := make([]T, 0, len(s))
+	for _, v := range s {
+		if fn(v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Map 对每个元素执行 fn，返回结果组成的 slice
+func Map[T, R any](s []T, fn func(T) R) []R {
+	result := make([]R, 0, len(s))
+	for _, v := range s {
+		result = append(result, fn(v))
+	}
+	return result
+}
+
+// Reduce 从 initial 开始依次累积每个元素
+func Reduce[T, R any](s []T, initial R, fn func(acc R, v T) R) R {
+	acc := initial
+	for _, v := range s {
+		acc = fn(acc, v)
+	}
+	return acc
+}
+
+// Chunk 按 size 分块，最后一块可能不足 size；size 小于 1 时返回 nil
+func Chunk[T any](s []T, size int) [][]T {
+	if size < 1 {
+		return nil
+	}
+	result := make([][]T, 0, (len(s)+size-1)/size)
+	for i := 0; i < len(s); i += size {
+		end := i + size
+		if end > len(s) {
+			end = len(s)
+		}
+		result = append(result, s[i:end:end])
+	}
+	return result
+}
+
+// set slice 转为集合
+func set[T comparable](s []T) map[T]struct{} {
+	m := make(map[T]struct{}, len(s))
+	for _, v := range s {
+		m[v] = struct{}{}
+	}
+	return m
+}
+
+// Diff 在 a 中但不在 b 中的元素，保留 a 的顺序并去重
+func Diff[T comparable](a, b []T) []T {
+	exclude := set(b)
+	return Filter(Unique(a), func(v T) bool {
+		_, ok := exclude[v]
+		return !ok
+	})
+}
+
+// Intersect 同时在 a 和 b 中的元素，保留 a 的顺序并去重
+func Intersect[T comparable](a, b []T) []T {
+	include := set(b)
+	return Filter(Unique(a), func(v T) bool {
+		_, ok := include[v]
+		return ok
+	})
+}
+
+// Union 合并多个 slice 并去重，保留第一次出现的顺序
+func Union[T comparable](slices ...[]T) []T {
+	var n int
+	for _, s := range slices {
+		n += len(s)
+	}
+	all := make([]T, 0, n)
+	for _, s := range slices {
+		all = append(all, s...)
+	}
+	return Unique(all)
+}
+
+// GroupBy 按 fn 返回的 key 分组，组内保留原顺序
+func GroupBy[T any, K comparable](s []T, fn func(T) K) map[K][]T {
+	result := make(map[K][]T)
+	for _, v := range s {
+		k := fn(v)
+		result[k] = append(result[k], v)
+	}
+	return result
+}
+
+// KeyBy 按 fn 返回的 key 建立索引，key 重复时后者覆盖前者
+func KeyBy[T any, K comparable](s []T, fn func(T) K) map[K]T {
+	result := make(map[K]T, len(s))
+	for _, v := range s {
+		result[fn(v)] = v
+	}
+	return result
+}
+
+// Keys map 的 key，升序排列
+func Keys[K goutil.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// Values map 的 value，按 key 升序排列
+func Values[K goutil.Ordered, V any](m map[K]V) []V {
+	values := make([]V, 0, len(m))
+	for _, k := range Keys(m) {
+		values = append(values, m[k])
+	}
+	return values
+}
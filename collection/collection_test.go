@@ -0,0 +1,51 @@
+package collection
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChunk(t *testing.T) {
+	tests := []struct {
+		s    []int
+		size int
+		want [][]int
+	}{
+		{[]int{1, 2, 3, 4, 5}, 2, [][]int{{1, 2}, {3, 4}, {5}}},
+		{[]int{1, 2, 3, 4}, 2, [][]int{{1, 2}, {3, 4}}},
+		{[]int{1, 2}, 5, [][]int{{1, 2}}},
+		{[]int{}, 2, [][]int{}},
+		{[]int{1, 2}, 0, nil},
+		{[]int{1, 2}, -1, nil},
+	}
+	for _, tt := range tests {
+		if got := Chunk(tt.s, tt.size); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Chunk(%v, %d) = %v, want %v", tt.s, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestChunkAppendDoesNotOverwriteNext(t *testing.T) {
+	s := []int{1, 2, 3, 4}
+	chunks := Chunk(s, 2)
+	_ = append(chunks[0], 9)
+	if !reflect.DeepEqual(s, []int{1, 2, 3, 4}) || !reflect.DeepEqual(chunks[1], []int{3, 4}) {
+		t.Fatalf("append to chunk changed source: %v %v", s, chunks)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b, want []string
+	}{
+		{[]string{"a", "b", "c", "b"}, []string{"c"}, []string{"a", "b"}},
+		{[]string{"c", "a", "a"}, nil, []string{"c", "a"}},
+		{[]string{"a"}, []string{"a", "b"}, []string{}},
+		{nil, []string{"a"}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := Diff(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Diff(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package collection
+
+import (
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Column 取出每一行中 column 列的值，与 PHP array_column 一致；
+// rows 为结构体（或其指针）slice 时按字段名或 json tag 匹配，为 map slice 时按 key 匹配，
+// 不包含该列或值无法转换为 V 的行被跳过；值为 nil 时 V 为接口类型则取零值，否则跳过；
+// 数字超出 V 的范围、负数转无符号整数时跳过，浮点数只在没有小数部分时转换为整数
+//
+//	ids := collection.Column[int](users, "ID")
+//	names := collection.Column[string]([]map[string]any{{"name": "a"}}, "name")
+func Column[V any](rows any, column string) []V {
+	rv := reflect.ValueOf(rows)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	result := make([]V, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		if v, ok := columnValue[V](rv.Index(i), column); ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// ColumnMap 以 indexKey 列为 key、column 列为 value，与 PHP array_column($rows, $column, $indexKey) 一致；
+// key 重复时后者覆盖前者
+func ColumnMap[K comparable, V any](rows any, column, indexKey string) map[K]V {
+	rv := reflect.ValueOf(rows)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	result := make(map[K]V, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		row := rv.Index(i)
+		k, ok := columnValue[K](row, indexKey)
+		if !ok {
+			continue
+		}
+		if v, ok := columnValue[V](row, column); ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// columnValue 读取一行中的列并转换为 T
+func columnValue[T any](row reflect.Value, column string) (T, bool) {
+	var zero T
+	field, ok := lookupColumn(row, column)
+	if !ok {
+		return zero, false
+	}
+	target := reflect.TypeOf((*T)(nil)).Elem()
+	for field.Kind() == reflect.Interface && !field.IsNil() && field.Type() != target {
+		field = field.Elem()
+	}
+	if !field.IsValid() || field.Kind() == reflect.Interface && field.IsNil() {
+		return zero, target.Kind() == reflect.Interface
+	}
+	switch {
+	case field.Type().AssignableTo(target):
+	case field.Type().ConvertibleTo(target) && sameKindGroup(field.Kind(), target.Kind()):
+		if !fitsNumber(field, target) {
+			return zero, false
+		}
+		field = field.Convert(target)
+	default:
+		return zero, false
+	}
+	v, ok := field.Interface().(T)
+	return v, ok
+}
+
+// fitsNumber 数字转换为 target 时是否不溢出、不改变符号、不丢失小数部分，非数字返回 true
+func fitsNumber(field reflect.Value, target reflect.Type) bool {
+	to := reflect.New(target).Elem()
+	switch {
+	case isInt(field.Kind()):
+		i := field.Int()
+		switch {
+		case isInt(target.Kind()):
+			return !to.OverflowInt(i)
+		case isUint(target.Kind()):
+			return i >= 0 && !to.OverflowUint(uint64(i))
+		}
+	case isUint(field.Kind()):
+		u := field.Uint()
+		switch {
+		case isInt(target.Kind()):
+			return u <= math.MaxInt64 && !to.OverflowInt(int64(u))
+		case isUint(target.Kind()):
+			return !to.OverflowUint(u)
+		}
+	case isFloat(field.Kind()):
+		f := field.Float()
+		switch {
+		case isFloat(target.Kind()):
+			return math.IsNaN(f) || math.IsInf(f, 0) || !to.OverflowFloat(f)
+		case f != math.Trunc(f) || math.IsInf(f, 0):
+			return false
+		case isInt(target.Kind()):
+			return f >= math.MinInt64 && f < math.MaxInt64 && !to.OverflowInt(int64(f))
+		case isUint(target.Kind()):
+			return f >= 0 && f < math.MaxUint64 && !to.OverflowUint(uint64(f))
+		}
+	}
+	return true
+}
+
+// isInt 是否有符号整数
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+// isUint 是否无符号整数
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+// isFloat 是否浮点数
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+// sameKindGroup 只在数字之间或字符串之间转换，避免 int 转 string 得到字符
+func sameKindGroup(a, b reflect.Kind) bool {
+	isNumber := func(k reflect.Kind) bool {
+		return k >= reflect.Int && k <= reflect.Float64
+	}
+	if isNumber(a) && isNumber(b) {
+		return true
+	}
+	return a == b
+}
+
+// lookupColumn 在结构体或 map 中查找列
+func lookupColumn(row reflect.Value, column string) (reflect.Value, bool) {
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		if row.IsNil() {
+			return reflect.Value{}, false
+		}
+		row = row.Elem()
+	}
+	switch row.Kind() {
+	case reflect.Map:
+		if row.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}, false
+		}
+		v := row.MapIndex(reflect.ValueOf(column).Convert(row.Type().Key()))
+		return v, v.IsValid()
+	case reflect.Struct:
+		if f := row.FieldByName(column); f.IsValid() && f.CanInterface() {
+			return f, true
+		}
+		t := row.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name == column {
+				return row.Field(i), true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
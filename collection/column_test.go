@@ -0,0 +1,100 @@
+package collection
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+type columnUser struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Score float64
+	Tag   any
+	email string
+}
+
+func TestColumnStruct(t *testing.T) {
+	users := []columnUser{
+		{ID: 1, Name: "a", Score: 1.5, Tag: "x"},
+		{ID: 2, Name: "b", Score: 2, email: "b@example.com"},
+	}
+	if got := Column[int64](users, "ID"); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("Column by field name = %v", got)
+	}
+	if got := Column[string](users, "name"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Column by json tag = %v", got)
+	}
+	if got := Column[int]([]*columnUser{&users[0], nil, &users[1]}, "id"); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("Column of pointer rows = %v", got)
+	}
+	// 有小数部分的浮点数不转换为整数
+	if got := Column[int](users, "Score"); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("Column float to int = %v", got)
+	}
+	// nil 接口值只在 V 为接口类型时保留
+	if got := Column[any](users, "Tag"); !reflect.DeepEqual(got, []any{"x", nil}) {
+		t.Errorf("Column any = %v", got)
+	}
+	if got := Column[string](users, "Tag"); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("Column nil skipped = %v", got)
+	}
+	if got := Column[string](users, "email"); len(got) != 0 {
+		t.Errorf("Column of unexported field = %v", got)
+	}
+	if got := Column[int](users[0], "ID"); got != nil {
+		t.Errorf("Column of non-slice = %v", got)
+	}
+}
+
+func TestColumnMapRows(t *testing.T) {
+	rows := []map[string]any{
+		{"id": 1, "name": "a"},
+		{"id": 2.0},
+		{"name": "c"},
+		{"id": "3"},
+	}
+	if got := Column[int](rows, "id"); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("Column of maps = %v", got)
+	}
+	// 数字不转换为字符串
+	if got := Column[string](rows, "id"); !reflect.DeepEqual(got, []string{"3"}) {
+		t.Errorf("Column number to string = %v", got)
+	}
+	want := map[int]string{1: "a"}
+	if got := ColumnMap[int, string](rows, "name", "id"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ColumnMap = %v, want %v", got, want)
+	}
+}
+
+func TestColumnNumberRange(t *testing.T) {
+	rows := []map[string]any{
+		{"v": 300},
+		{"v": -1},
+		{"v": 255},
+		{"v": uint64(math.MaxUint64)},
+		{"v": 1e20},
+		{"v": -128.0},
+		{"v": math.Inf(1)},
+	}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"uint8", Column[uint8](rows, "v"), []uint8{255}},
+		{"int8", Column[int8](rows, "v"), []int8{-1, -128}},
+		{"uint", Column[uint](rows, "v"), []uint{300, 255, math.MaxUint64}},
+		{"int64", Column[int64](rows, "v"), []int64{300, -1, 255, -128}},
+		{"float32", Column[float32](rows, "v"), []float32{300, -1, 255, math.MaxUint64, 1e20, -128, float32(math.Inf(1))}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("Column[%s] = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	large := []map[string]float64{{"v": 3.5e38}}
+	if got := Column[float32](large, "v"); len(got) != 0 {
+		t.Errorf("Column float32 overflow = %v", got)
+	}
+}
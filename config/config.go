@@ -1,15 +1,18 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/aidenliu/goutil"
 	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -42,6 +45,12 @@ var VendorConfig = make(map[string]map[string]string)
 // DbConfig 数据库配置
 var DbConfig = dbConfig{}
 
+// ErrServiceNotFound service.yaml 中不存在该配置项
+var ErrServiceNotFound = errors.New("service config not found")
+
+// serviceViper service.yaml 原始配置，用于读取嵌套结构的服务配置
+var serviceViper *viper.Viper
+
 func init() {
 	log.SetFlags(log.Lshortfile | log.Lmicroseconds | log.Ldate)
 }
@@ -136,13 +145,14 @@ func InitLoad() error {
 		if err := vp.ReadInConfig(); err != nil {
 			return err
 		} else {
-			if err := vp.Unmarshal(&ServiceConfig); err != nil {
+			if err := unmarshalService(vp); err != nil {
 				return err
 			}
+			serviceViper = vp
 			// 自动载入配置
 			vp.OnConfigChange(func(e fsnotify.Event) {
-				err := vp.Unmarshal(&ServiceConfig)
-				log.Printf("config file[%s] has changed, reload[%s]\n", e.Name, err)
+				err := unmarshalService(vp)
+				log.Printf("config file[%s] has changed, reload[%v]\n", e.Name, err)
 			})
 			vp.WatchConfig()
 		}
@@ -186,6 +196,44 @@ func InitLoad() error {
 	return nil
 }
 
+// unmarshalService 解析服务配置，ServiceConfig 只保留标量配置项，嵌套结构通过 ServiceDecode 读取；
+// 标量与 viper.Unmarshal 一致按弱类型转换为字符串（如 true 转为 "1"）；顶层配置项不是 map 时跳过并返回错误
+func unmarshalService(vp *viper.Viper) error {
+	var invalid, badValues []string
+	services := make(map[string]map[string]string)
+	for key, value := range vp.AllSettings() {
+		item, ok := value.(map[string]interface{})
+		if !ok {
+			invalid = append(invalid, key)
+			continue
+		}
+		flat := make(map[string]string)
+		for k, v := range item {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				continue
+			}
+			var str string
+			if err := mapstructure.WeakDecode(v, &str); err != nil {
+				badValues = append(badValues, key+"."+k)
+				continue
+			}
+			flat[k] = str
+		}
+		services[key] = flat
+	}
+	ServiceConfig = services
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("service config %s is not a map", strings.Join(invalid, ","))
+	}
+	if len(badValues) > 0 {
+		sort.Strings(badValues)
+		return fmt.Errorf("service config %s can not convert to string", strings.Join(badValues, ","))
+	}
+	return nil
+}
+
 func ConstantGroup(constantType, groupKey string) map[string]string {
 	var constConfig map[string]map[string]string
 	switch constantType {
@@ -218,6 +266,14 @@ func Service(key string) map[string]string {
 	return c
 }
 
+// ServiceDecode 将服务配置解析到结构体，支持嵌套结构，配置项不存在时返回 ErrServiceNotFound
+func ServiceDecode(key string, data any) error {
+	if serviceViper == nil || !serviceViper.IsSet(key) {
+		return fmt.Errorf("%w: %s", ErrServiceNotFound, key)
+	}
+	return serviceViper.UnmarshalKey(key, data)
+}
+
 // Vendor 第三方服务配置
 func Vendor(key string) map[string]string {
 	c, exists := VendorConfig[key]
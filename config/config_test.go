@@ -0,0 +1,62 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const serviceYaml = `
+mq:
+  host: 127.0.0.1:5672
+  ssl: true
+  retry: false
+  port: 5672
+  ratio: 0.5
+  topology:
+    queues:
+      - {name: jobs}
+  hosts: [a, b]
+`
+
+func TestUnmarshalServiceScalars(t *testing.T) {
+	vp := viper.New()
+	vp.SetConfigType("yaml")
+	if err := vp.ReadConfig(strings.NewReader(serviceYaml)); err != nil {
+		t.Fatal(err)
+	}
+	if err := unmarshalService(vp); err != nil {
+		t.Fatal(err)
+	}
+	// 与 viper.Unmarshal 到 map[string]map[string]string 的转换结果一致
+	want := map[string]string{
+		"host":  "127.0.0.1:5672",
+		"ssl":   "1",
+		"retry": "0",
+		"port":  "5672",
+		"ratio": "0.5",
+	}
+	got := Service("mq")
+	if len(got) != len(want) {
+		t.Fatalf("service mq = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("service mq %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestUnmarshalServiceNotMap(t *testing.T) {
+	vp := viper.New()
+	vp.Set("mq", map[string]interface{}{"host": "127.0.0.1"})
+	vp.Set("version", "1.0")
+	err := unmarshalService(vp)
+	if err == nil || !strings.Contains(err.Error(), "version") {
+		t.Fatalf("err = %v, want version is not a map", err)
+	}
+	if Service("mq")["host"] != "127.0.0.1" {
+		t.Fatalf("valid service mq = %v, want kept", Service("mq"))
+	}
+}
@@ -1,7 +1,6 @@
 package couchbase
 
 import (
-	"errors"
 	"fmt"
 	"gopkg.in/couchbase/gocb.v1"
 	"sync"
@@ -9,6 +8,9 @@ import (
 
 type Cb struct {
 	*gocb.Bucket
+	cluster   *gocb.Cluster
+	conn      *poolConn
+	closeOnce sync.Once
 }
 
 type multiValueType struct {
@@ -21,96 +23,90 @@ type multiValueMapType struct {
 	Value *map[string]interface{}
 }
 
-var lock sync.Mutex
-var cbPool = map[string]Cb{}
-
+// New 使用连接串和 bucket 名创建 v1 客户端，需要认证时使用 NewWithConfig
 func New(hostConfig, bucketConfig string) (*Cb, error) {
-	poolKey := fmt.Sprintf("%s%s", hostConfig, bucketConfig)
-	lock.Lock()
-	defer lock.Unlock()
+	return newV1(Config{Host: hostConfig, Bucket: bucketConfig})
+}
 
-	cb, ok := cbPool[poolKey]
-	if !ok || cb.Bucket == nil {
-		cluster, err := gocb.Connect(hostConfig)
-		if err != nil {
-			return nil, err
-		}
+// newV1 从连接池获取 v1 客户端，连接异常时重新打开
+func newV1(cfg Config) (*Cb, error) {
+	// 认证信息和超时设置都作用于共享连接，不同时使用独立的连接
+	poolKey := fmt.Sprintf("v1|%s|%s|%s|%s|%s|%s|%s|%s", cfg.Host, cfg.Bucket, cfg.Username,
+		secretHash(cfg.Password), secretHash(cfg.BucketPassword),
+		cfg.ConnectTimeout, cfg.OperationTimeout, cfg.QueryTimeout)
+	pc, err := acquire(poolKey, func() (*poolConn, error) {
+		return openV1(cfg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Cb{Bucket: pc.v1Bucket, cluster: pc.v1Cluster, conn: pc}, nil
+}
 
-		bucket, err := cluster.OpenBucket(bucketConfig, "")
-		if err != nil {
+// openV1 连接集群并打开 bucket
+func openV1(cfg Config) (*poolConn, error) {
+	cluster, err := gocb.Connect(cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ConnectTimeout > 0 {
+		cluster.SetConnectTimeout(cfg.ConnectTimeout)
+	}
+	if cfg.Username != "" {
+		if err = cluster.Authenticate(gocb.PasswordAuthenticator{Username: cfg.Username, Password: cfg.Password}); err != nil {
 			return nil, err
 		}
-
-		cb = Cb{bucket}
-		cbPool[poolKey] = cb
 	}
-
-	return &cb, nil
-}
-
-func (c *Cb) Get(key string, rv interface{}) error {
-	_, err := c.Bucket.Get(key, rv)
-	return err
+	bucket, err := cluster.OpenBucket(cfg.Bucket, cfg.BucketPassword)
+	if err != nil {
+		_ = cluster.Close()
+		return nil, err
+	}
+	if cfg.OperationTimeout > 0 {
+		bucket.SetOperationTimeout(cfg.OperationTimeout)
+		bucket.SetBulkOperationTimeout(cfg.OperationTimeout)
+	}
+	if cfg.QueryTimeout > 0 {
+		bucket.SetN1qlTimeout(cfg.QueryTimeout)
+	}
+	return &poolConn{v1Cluster: cluster, v1Bucket: bucket}, nil
 }
 
-func (c *Cb) GetMulti(keys []string) (error, []*multiValueType) {
-	var r []*multiValueType
-	var items []gocb.BulkOp
-	var err error
-
-	for _, k := range keys {
-		var value string
-		items = append(items, &gocb.GetOp{Key: k, Value: &value})
+// pingV1 检查 KV 服务是否可用
+func pingV1(bucket *gocb.Bucket) error {
+	report, err := bucket.Ping([]gocb.ServiceType{gocb.MemdService})
+	if err != nil {
+		return err
 	}
-
-	if err = c.Do(items); err == nil {
-		for _, gv := range items {
-			v := gv.(*gocb.GetOp)
-			r = append(r, &multiValueType{Key: v.Key, Value: v.Value.(*string)})
+	for _, s := range report.Services {
+		if !s.Success {
+			return fmt.Errorf("couchbase: ping %s failed", s.Endpoint)
 		}
 	}
-	return err, r
+	return nil
 }
 
-func (c *Cb) GetMultiMap(keys []string) (error, []*multiValueMapType) {
-	var r []*multiValueMapType
-	var items []gocb.BulkOp
+// Close 释放客户端，重复调用无效；共享连接在所有客户端都关闭后才断开
+func (c *Cb) Close() error {
 	var err error
+	c.closeOnce.Do(func() {
+		err = c.conn.release()
+	})
+	return err
+}
 
-	for _, k := range keys {
-		var value map[string]interface{}
-		items = append(items, &gocb.GetOp{Key: k, Value: &value})
-	}
-
-	loopCount := len(items) / 2000
-	for i := 0; i <= loopCount; i++ {
-		si := i * 2000
-		se := si + 2000
-		if se >= len(items) {
-			se = len(items)
-		}
-		subItems := items[si:se]
-		if err = c.Do(subItems); err == nil {
-			var retryItems []gocb.BulkOp
-			for _, gv := range subItems {
-				v := gv.(*gocb.GetOp)
-				if errors.Is(v.Err, gocb.ErrOverload) {
-					retryItems = append(retryItems, v)
-				} else {
-					r = append(r, &multiValueMapType{Key: v.Key, Value: v.Value.(*map[string]interface{})})
-				}
-			}
+func (c *Cb) Get(key string, rv interface{}) error {
+	_, err := c.Bucket.Get(key, rv)
+	return err
+}
 
-			if len(retryItems) > 0 {
-				if err = c.Do(retryItems); err == nil {
-					for _, gv := range retryItems {
-						v := gv.(*gocb.GetOp)
-						r = append(r, &multiValueMapType{Key: v.Key, Value: v.Value.(*map[string]interface{})})
-					}
-				}
-			}
-		}
-	}
+// GetMulti 批量读取字符串值，按 keys 顺序返回，不存在的 key 被跳过；
+// 需要其他类型或区分失败原因时使用 GetMulti[T]
+func (c *Cb) GetMulti(keys []string) ([]*multiValueType, error) {
+	return getMultiString(c, keys)
+}
 
-	return err, r
+// GetMultiMap 批量读取 JSON 对象，按 keys 顺序返回，不存在的 key 被跳过
+func (c *Cb) GetMultiMap(keys []string) ([]*multiValueMapType, error) {
+	return getMultiMap(c, keys)
 }
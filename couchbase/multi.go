@@ -0,0 +1,266 @@
+package couchbase
+
+import (
+	"errors"
+	"fmt"
+	gocbv2 "github.com/couchbase/gocb/v2"
+	"gopkg.in/couchbase/gocb.v1"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MultiOptions 批量读取选项，nil 使用默认值
+type MultiOptions struct {
+	// BatchSize 每批 key 数量，默认 1000
+	BatchSize int
+	// Concurrency 并发批次数，默认 4
+	Concurrency int
+	// Retries 过载时的重试次数，默认 3
+	Retries int
+	// Backoff 首次重试等待时间，之后每次翻倍，默认 50ms
+	Backoff time.Duration
+}
+
+// MultiResult 批量读取结果
+type MultiResult[T any] struct {
+	// Values 读取成功的文档
+	Values map[string]T
+	// Missing 不存在的 key
+	Missing []string
+	// Failed 读取失败的 key 及原因
+	Failed map[string]error
+}
+
+// Err 存在失败的 key 时返回 MultiError，不存在的 key 不视为错误
+func (r *MultiResult[T]) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	return MultiError(r.Failed)
+}
+
+// MultiError 批量操作中各 key 的错误
+type MultiError map[string]error
+
+func (e MultiError) Error() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	const maxShown = 3
+	parts := make([]string, 0, maxShown)
+	for i, k := range keys {
+		if i == maxShown {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s: %v", k, e[k]))
+	}
+	msg := fmt.Sprintf("couchbase: %d keys failed: %s", len(e), strings.Join(parts, "; "))
+	if len(keys) > maxShown {
+		msg += "; ..."
+	}
+	return msg
+}
+
+// bulkItem 批量读取的单个 key，value 为解码目标指针
+type bulkItem struct {
+	key   string
+	value interface{}
+	err   error
+}
+
+// bulkGetter 支持批量读取的客户端
+type bulkGetter interface {
+	// bulkGet 批量读取并填充每个 key 的 value/err
+	bulkGet(items []*bulkItem)
+}
+
+// isOverload 是否为可重试的过载或临时错误
+func isOverload(err error) bool {
+	return errors.Is(err, gocb.ErrOverload) || errors.Is(err, gocb.ErrTmpFail) ||
+		errors.Is(err, gocbv2.ErrOverload) || errors.Is(err, gocbv2.ErrTemporaryFailure)
+}
+
+// GetMulti 批量读取并解码为 T，按 BatchSize 分批并发执行，过载时退避重试
+//
+//	res := couchbase.GetMulti[User](cb, keys, nil)
+//	if err := res.Err(); err != nil {
+//		// res.Failed 中为失败的 key，res.Values 仍包含成功的部分
+//	}
+func GetMulti[T any](c Client, keys []string, opts *MultiOptions) *MultiResult[T] {
+	o := MultiOptions{BatchSize: 1000, Concurrency: 4, Retries: 3, Backoff: 50 * time.Millisecond}
+	if opts != nil {
+		if opts.BatchSize > 0 {
+			o.BatchSize = opts.BatchSize
+		}
+		if opts.Concurrency > 0 {
+			o.Concurrency = opts.Concurrency
+		}
+		if opts.Retries > 0 {
+			o.Retries = opts.Retries
+		}
+		if opts.Backoff > 0 {
+			o.Backoff = opts.Backoff
+		}
+	}
+	res := &MultiResult[T]{Values: make(map[string]T, len(keys)), Failed: map[string]error{}}
+	getter, ok := c.(bulkGetter)
+	if !ok {
+		for _, k := range keys {
+			res.Failed[k] = fmt.Errorf("couchbase: %T does not support bulk get", c)
+		}
+		return res
+	}
+
+	seen := make(map[string]bool, len(keys))
+	unique := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			unique = append(unique, k)
+		}
+	}
+	batches := make(chan []string)
+	go func() {
+		defer close(batches)
+		for i := 0; i < len(unique); i += o.BatchSize {
+			end := i + o.BatchSize
+			if end > len(unique) {
+				end = len(unique)
+			}
+			batches <- unique[i:end]
+		}
+	}()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for w := 0; w < o.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				items := getBatch[T](getter, batch, o)
+				mu.Lock()
+				for _, item := range items {
+					switch {
+					case item.err == nil:
+						res.Values[item.key] = *item.value.(*T)
+					case IsNotFound(item.err):
+						res.Missing = append(res.Missing, item.key)
+					default:
+						res.Failed[item.key] = item.err
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Strings(res.Missing)
+	return res
+}
+
+// getBatch 读取一批 key，过载的 key 退避后重试
+func getBatch[T any](getter bulkGetter, keys []string, o MultiOptions) []*bulkItem {
+	items := make([]*bulkItem, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, &bulkItem{key: k})
+	}
+	pending := items
+	backoff := o.Backoff
+	for attempt := 0; ; attempt++ {
+		for _, item := range pending {
+			item.value, item.err = new(T), nil
+		}
+		getter.bulkGet(pending)
+		var retry []*bulkItem
+		for _, item := range pending {
+			if isOverload(item.err) {
+				retry = append(retry, item)
+			}
+		}
+		if len(retry) == 0 || attempt >= o.Retries {
+			return items
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		pending = retry
+	}
+}
+
+// bulkGet 每个操作使用各自的结果，Do 的错误只用于未完成的操作
+func (c *Cb) bulkGet(items []*bulkItem) {
+	ops := make([]gocb.BulkOp, 0, len(items))
+	for _, item := range items {
+		ops = append(ops, &gocb.GetOp{Key: item.key, Value: item.value})
+	}
+	doErr := c.Do(ops)
+	for i, op := range ops {
+		getOp := op.(*gocb.GetOp)
+		items[i].err = getOp.Err
+		// 读取成功时 Cas 不为 0，两者都为空说明操作未完成
+		if getOp.Err == nil && getOp.Cas == 0 && doErr != nil {
+			items[i].err = doErr
+		}
+	}
+}
+
+func (c *CbV2) bulkGet(items []*bulkItem) {
+	ops := make([]gocbv2.BulkOp, 0, len(items))
+	for _, item := range items {
+		ops = append(ops, &gocbv2.GetOp{ID: item.key})
+	}
+	doErr := c.collection.Do(ops, nil)
+	for i, op := range ops {
+		getOp := op.(*gocbv2.GetOp)
+		switch {
+		case getOp.Err != nil:
+			items[i].err = getOp.Err
+		case getOp.Result != nil:
+			items[i].err = getOp.Result.Content(items[i].value)
+		case doErr != nil:
+			items[i].err = doErr
+		}
+	}
+}
+
+// multiValues 按 keys 顺序返回读取到的值，不存在的 key 被跳过
+func multiValues[T any](c Client, keys []string) ([]string, map[string]T, error) {
+	res := GetMulti[T](c, keys, nil)
+	found := make([]string, 0, len(res.Values))
+	seen := make(map[string]bool, len(res.Values))
+	for _, k := range keys {
+		if _, ok := res.Values[k]; ok && !seen[k] {
+			seen[k] = true
+			found = append(found, k)
+		}
+	}
+	return found, res.Values, res.Err()
+}
+
+// getMultiString GetMulti 的通用实现
+func getMultiString(c Client, keys []string) ([]*multiValueType, error) {
+	found, values, err := multiValues[string](c, keys)
+	r := make([]*multiValueType, 0, len(found))
+	for _, k := range found {
+		v := values[k]
+		r = append(r, &multiValueType{Key: k, Value: &v})
+	}
+	return r, err
+}
+
+// getMultiMap GetMultiMap 的通用实现
+func getMultiMap(c Client, keys []string) ([]*multiValueMapType, error) {
+	found, values, err := multiValues[map[string]interface{}](c, keys)
+	r := make([]*multiValueMapType, 0, len(found))
+	for _, k := range found {
+		v := values[k]
+		r = append(r, &multiValueMapType{Key: k, Value: &v})
+	}
+	return r, err
+}
@@ -0,0 +1,280 @@
+package couchbase
+
+import (
+	"errors"
+	gocbv2 "github.com/couchbase/gocb/v2"
+	"gopkg.in/couchbase/gocb.v1"
+	"time"
+)
+
+// Cas 文档版本号，用于乐观锁
+type Cas uint64
+
+// WriteOptions 写操作选项，nil 表示不过期、不校验 CAS
+type WriteOptions struct {
+	// Expiry 过期时间，0 表示不过期
+	Expiry time.Duration
+	// Cas Replace/Remove 时校验文档版本，0 表示不校验
+	Cas Cas
+	// PreserveExpiry Expiry 为 0 时保留文档原有的过期时间，仅 v2 支持（服务端 7.0+），v1 忽略该选项
+	PreserveExpiry bool
+}
+
+// Mutate 最大重试次数
+const mutateRetries = 10
+
+// expiry 读取过期时间
+func (o *WriteOptions) expiry() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.Expiry
+}
+
+// preserveExpiry 是否保留原有过期时间，设置了 Expiry 时以 Expiry 为准
+func (o *WriteOptions) preserveExpiry() bool {
+	return o != nil && o.PreserveExpiry && o.Expiry <= 0
+}
+
+// cas 读取 CAS
+func (o *WriteOptions) cas() Cas {
+	if o == nil {
+		return 0
+	}
+	return o.Cas
+}
+
+// expirySeconds 转换为 v1 的过期参数，超过 30 天时服务端按 unix 时间戳解析
+func expirySeconds(d time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+	secs := int64((d + time.Second - 1) / time.Second)
+	if secs > 30*24*3600 {
+		return uint32(time.Now().Unix() + secs)
+	}
+	return uint32(secs)
+}
+
+// lockSeconds 转换为 v1 的锁定秒数，不足 1 秒按 1 秒，0 时服务端使用默认的 15 秒
+func lockSeconds(d time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+	return uint32((d + time.Second - 1) / time.Second)
+}
+
+// IsNotFound 文档不存在
+func IsNotFound(err error) bool {
+	return errors.Is(err, gocb.ErrKeyNotFound) || errors.Is(err, gocbv2.ErrDocumentNotFound)
+}
+
+// IsExists Insert 时文档已存在
+func IsExists(err error) bool {
+	return errors.Is(err, gocb.ErrKeyExists) || errors.Is(err, gocbv2.ErrDocumentExists)
+}
+
+// IsCasMismatch CAS 不一致，v1 以 key exists 错误返回
+func IsCasMismatch(err error) bool {
+	return errors.Is(err, gocbv2.ErrCasMismatch) || errors.Is(err, gocb.ErrKeyExists)
+}
+
+// IsLocked 文档已被 GetAndLock 锁定，v1 以临时失败返回
+func IsLocked(err error) bool {
+	return errors.Is(err, gocbv2.ErrDocumentLocked) || errors.Is(err, gocb.ErrTmpFail)
+}
+
+// Mutate CAS 乐观锁更新：读取文档，fn 修改后按读取时的 CAS 写回，CAS 不一致时重新读取重试；
+// fn 返回错误时放弃更新并返回该错误。opts 未设置 Expiry 时 v2 保留文档原有的过期时间；
+// v1 不支持保留，写回会清除过期时间，文档带过期时间时需通过 opts.Expiry 重新指定
+//
+//	_, err := couchbase.Mutate(cb, "user::1", func(u *User) error {
+//		u.Score += 10
+//		return nil
+//	}, nil)
+func Mutate[T any](c Client, key string, fn func(doc *T) error, opts *WriteOptions) (Cas, error) {
+	var err error
+	for i := 0; i < mutateRetries; i++ {
+		doc := new(T)
+		var cas Cas
+		if cas, err = c.GetCas(key, doc); err != nil {
+			return 0, err
+		}
+		if err = fn(doc); err != nil {
+			return 0, err
+		}
+		cas, err = c.Replace(key, doc, &WriteOptions{Expiry: opts.expiry(), Cas: cas, PreserveExpiry: true})
+		if err == nil {
+			return cas, nil
+		}
+		if !IsCasMismatch(err) {
+			return 0, err
+		}
+		time.Sleep(time.Duration(i+1) * 5 * time.Millisecond)
+	}
+	return 0, err
+}
+
+// GetCas 读取文档并返回 CAS
+func (c *Cb) GetCas(key string, rv interface{}) (Cas, error) {
+	cas, err := c.Bucket.Get(key, rv)
+	return Cas(cas), err
+}
+
+// Upsert 写入文档，存在时覆盖
+func (c *Cb) Upsert(key string, value interface{}, opts *WriteOptions) (Cas, error) {
+	cas, err := c.Bucket.Upsert(key, value, expirySeconds(opts.expiry()))
+	return Cas(cas), err
+}
+
+// Insert 写入文档，已存在时返回错误，可用 IsExists 判断
+func (c *Cb) Insert(key string, value interface{}, opts *WriteOptions) (Cas, error) {
+	cas, err := c.Bucket.Insert(key, value, expirySeconds(opts.expiry()))
+	return Cas(cas), err
+}
+
+// Replace 替换已存在的文档，opts.Cas 不为 0 时校验版本
+func (c *Cb) Replace(key string, value interface{}, opts *WriteOptions) (Cas, error) {
+	cas, err := c.Bucket.Replace(key, value, gocb.Cas(opts.cas()), expirySeconds(opts.expiry()))
+	return Cas(cas), err
+}
+
+// Remove 删除文档，cas 不为 0 时校验版本
+func (c *Cb) Remove(key string, cas Cas) (Cas, error) {
+	newCas, err := c.Bucket.Remove(key, gocb.Cas(cas))
+	return Cas(newCas), err
+}
+
+// Touch 更新过期时间
+func (c *Cb) Touch(key string, expiry time.Duration) (Cas, error) {
+	cas, err := c.Bucket.Touch(key, 0, expirySeconds(expiry))
+	return Cas(cas), err
+}
+
+// GetAndLock 读取并锁定文档，锁定期间其他写操作失败，最长 30 秒
+func (c *Cb) GetAndLock(key string, lockTime time.Duration, rv interface{}) (Cas, error) {
+	cas, err := c.Bucket.GetAndLock(key, lockSeconds(lockTime), rv)
+	return Cas(cas), err
+}
+
+// Unlock 使用 GetAndLock 返回的 CAS 解锁
+func (c *Cb) Unlock(key string, cas Cas) error {
+	_, err := c.Bucket.Unlock(key, gocb.Cas(cas))
+	return err
+}
+
+// Counter 原子加减计数器，delta 为负数时递减；文档不存在时以 initial 创建，initial 为负数时不创建
+func (c *Cb) Counter(key string, delta, initial int64, expiry time.Duration) (uint64, Cas, error) {
+	value, cas, err := c.Bucket.Counter(key, delta, initial, expirySeconds(expiry))
+	return value, Cas(cas), err
+}
+
+// GetCas 读取文档并返回 CAS
+func (c *CbV2) GetCas(key string, rv interface{}) (Cas, error) {
+	res, err := c.collection.Get(key, nil)
+	if err != nil {
+		return 0, err
+	}
+	return Cas(res.Cas()), res.Content(rv)
+}
+
+// Upsert 写入文档，存在时覆盖
+func (c *CbV2) Upsert(key string, value interface{}, opts *WriteOptions) (Cas, error) {
+	res, err := c.collection.Upsert(key, value, &gocbv2.UpsertOptions{
+		Expiry:          opts.expiry(),
+		PreserveExpiry:  opts.preserveExpiry(),
+		DurabilityLevel: c.durability,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return Cas(res.Cas()), nil
+}
+
+// Insert 写入文档，已存在时返回错误，可用 IsExists 判断
+func (c *CbV2) Insert(key string, value interface{}, opts *WriteOptions) (Cas, error) {
+	res, err := c.collection.Insert(key, value, &gocbv2.InsertOptions{
+		Expiry:          opts.expiry(),
+		DurabilityLevel: c.durability,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return Cas(res.Cas()), nil
+}
+
+// Replace 替换已存在的文档，opts.Cas 不为 0 时校验版本
+func (c *CbV2) Replace(key string, value interface{}, opts *WriteOptions) (Cas, error) {
+	res, err := c.collection.Replace(key, value, &gocbv2.ReplaceOptions{
+		Expiry:          opts.expiry(),
+		PreserveExpiry:  opts.preserveExpiry(),
+		Cas:             gocbv2.Cas(opts.cas()),
+		DurabilityLevel: c.durability,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return Cas(res.Cas()), nil
+}
+
+// Remove 删除文档，cas 不为 0 时校验版本
+func (c *CbV2) Remove(key string, cas Cas) (Cas, error) {
+	res, err := c.collection.Remove(key, &gocbv2.RemoveOptions{
+		Cas:             gocbv2.Cas(cas),
+		DurabilityLevel: c.durability,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return Cas(res.Cas()), nil
+}
+
+// Touch 更新过期时间
+func (c *CbV2) Touch(key string, expiry time.Duration) (Cas, error) {
+	res, err := c.collection.Touch(key, expiry, nil)
+	if err != nil {
+		return 0, err
+	}
+	return Cas(res.Cas()), nil
+}
+
+// GetAndLock 读取并锁定文档，锁定期间其他写操作失败，最长 30 秒
+func (c *CbV2) GetAndLock(key string, lockTime time.Duration, rv interface{}) (Cas, error) {
+	res, err := c.collection.GetAndLock(key, lockTime, nil)
+	if err != nil {
+		return 0, err
+	}
+	return Cas(res.Cas()), res.Content(rv)
+}
+
+// Unlock 使用 GetAndLock 返回的 CAS 解锁
+func (c *CbV2) Unlock(key string, cas Cas) error {
+	return c.collection.Unlock(key, gocbv2.Cas(cas), nil)
+}
+
+// Counter 原子加减计数器，delta 为负数时递减；文档不存在时以 initial 创建，initial 为负数时不创建
+func (c *CbV2) Counter(key string, delta, initial int64, expiry time.Duration) (uint64, Cas, error) {
+	var (
+		res *gocbv2.CounterResult
+		err error
+	)
+	if delta >= 0 {
+		res, err = c.collection.Binary().Increment(key, &gocbv2.IncrementOptions{
+			Expiry:          expiry,
+			Initial:         initial,
+			Delta:           uint64(delta),
+			DurabilityLevel: c.durability,
+		})
+	} else {
+		res, err = c.collection.Binary().Decrement(key, &gocbv2.DecrementOptions{
+			Expiry:          expiry,
+			Initial:         initial,
+			Delta:           uint64(-delta),
+			DurabilityLevel: c.durability,
+		})
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return res.Content(), Cas(res.Cas()), nil
+}
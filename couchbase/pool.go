@@ -0,0 +1,228 @@
+package couchbase
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/aidenliu/goutil/config"
+	gocbv2 "github.com/couchbase/gocb/v2"
+	"gopkg.in/couchbase/gocb.v1"
+	"log"
+	"sync"
+	"time"
+)
+
+// Config 连接配置，NewFromConfig 从 service.yaml 同名配置读取：
+//
+//	couchbase:
+//	  host: couchbase://127.0.0.1
+//	  bucket: app
+//	  username: app
+//	  password: secret
+//	  operationTimeout: 2500ms
+//	  sdk: v2
+type Config struct {
+	Host   string
+	Bucket string
+	// Username、Password RBAC 认证
+	Username string
+	Password string
+	// BucketPassword 旧版本服务端的 bucket 密码，仅 v1 使用
+	BucketPassword string
+	// SDK v1 或 v2，默认 v1
+	SDK string
+	// Scope、Collection 仅 v2 使用
+	Scope      string
+	Collection string
+	// ConnectTimeout 连接超时
+	ConnectTimeout time.Duration
+	// OperationTimeout KV 操作超时
+	OperationTimeout time.Duration
+	// QueryTimeout N1QL 查询超时
+	QueryTimeout time.Duration
+}
+
+// 连接池中的连接超过该时间未检查时，获取前先 ping
+const healthCheckInterval = 10 * time.Second
+
+// ping 超时，v1、v2 都适用
+const pingTimeout = 2 * time.Second
+
+var lock sync.Mutex
+
+// pool 连接池，key 以 SDK 版本为前缀
+var pool = map[string]*poolConn{}
+
+// poolConn 连接池中的共享连接，由 New 返回的每个客户端各持有一个引用，
+// 健康检查失败时移出连接池，最后一个引用释放后才关闭，不影响仍在使用的客户端
+type poolConn struct {
+	key     string
+	refs    int
+	closed  bool
+	checked time.Time
+	// v1、v2 的底层连接，只设置其中一组
+	v1Cluster *gocb.Cluster
+	v1Bucket  *gocb.Bucket
+	v2Cluster *gocbv2.Cluster
+	v2Bucket  *gocbv2.Bucket
+}
+
+// NewFromConfig 按 service.yaml 中 key 对应的配置创建客户端，相同配置共享连接
+func NewFromConfig(key string) (Client, error) {
+	var cfg Config
+	if err := config.ServiceDecode(key, &cfg); err != nil {
+		return nil, fmt.Errorf("couchbase configKey %s: %w", key, err)
+	}
+	return NewWithConfig(cfg)
+}
+
+// NewWithConfig 按配置创建客户端，SDK 为 v2 时返回 *CbV2，否则返回 *Cb
+func NewWithConfig(cfg Config) (Client, error) {
+	switch cfg.SDK {
+	case "", "v1":
+		return newV1(cfg)
+	case "v2":
+		return NewV2(V2Config{
+			ConnStr:        cfg.Host,
+			Bucket:         cfg.Bucket,
+			Username:       cfg.Username,
+			Password:       cfg.Password,
+			Scope:          cfg.Scope,
+			Collection:     cfg.Collection,
+			ConnectTimeout: cfg.ConnectTimeout,
+			KVTimeout:      cfg.OperationTimeout,
+			QueryTimeout:   cfg.QueryTimeout,
+		})
+	}
+	return nil, fmt.Errorf("couchbase: unknown sdk %s", cfg.SDK)
+}
+
+// secretHash 连接池 key 中用于区分密码的摘要，不在 key 中保存明文
+func secretHash(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// acquire 从连接池获取连接并增加引用，距上次检查超过 healthCheckInterval 时先 ping，
+// ping 失败的连接移出连接池后重新打开；ping 和打开连接都不持有 lock
+func acquire(key string, open func() (*poolConn, error)) (*poolConn, error) {
+	lock.Lock()
+	pc, ok := pool[key]
+	if ok {
+		pc.refs++
+		if time.Since(pc.checked) < healthCheckInterval {
+			lock.Unlock()
+			return pc, nil
+		}
+		// 先更新检查时间，避免并发获取时重复 ping
+		pc.checked = time.Now()
+	}
+	lock.Unlock()
+	if ok {
+		err := pc.ping()
+		if err == nil {
+			return pc, nil
+		}
+		log.Printf("couchbase %s ping failure, reopen: %s\n", key, err)
+		lock.Lock()
+		if pool[key] == pc {
+			delete(pool, key)
+		}
+		lock.Unlock()
+		_ = pc.release()
+	}
+
+	opened, err := open()
+	if err != nil {
+		return nil, err
+	}
+	lock.Lock()
+	if cur, ok := pool[key]; ok {
+		// 并发打开时使用先放入连接池的连接
+		cur.refs++
+		lock.Unlock()
+		_ = opened.close()
+		return cur, nil
+	}
+	opened.key = key
+	opened.refs = 1
+	opened.checked = time.Now()
+	pool[key] = opened
+	lock.Unlock()
+	return opened, nil
+}
+
+// retain 增加引用
+func (pc *poolConn) retain() {
+	lock.Lock()
+	pc.refs++
+	lock.Unlock()
+}
+
+// release 释放引用，最后一个引用释放时移出连接池并关闭
+func (pc *poolConn) release() error {
+	lock.Lock()
+	pc.refs--
+	if pc.refs > 0 || pc.closed {
+		lock.Unlock()
+		return nil
+	}
+	if pool[pc.key] == pc {
+		delete(pool, pc.key)
+	}
+	pc.closed = true
+	lock.Unlock()
+	return pc.close()
+}
+
+// ping 检查 KV 服务是否可用，超过 pingTimeout 视为失败
+func (pc *poolConn) ping() error {
+	if pc.v2Bucket != nil {
+		return pingV2(pc.v2Bucket)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- pingV1(pc.v1Bucket)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(pingTimeout):
+		return fmt.Errorf("couchbase: ping timeout after %s", pingTimeout)
+	}
+}
+
+// close 关闭底层连接
+func (pc *poolConn) close() error {
+	if pc.v2Cluster != nil {
+		return pc.v2Cluster.Close(nil)
+	}
+	return pc.v1Cluster.Close()
+}
+
+// CloseAll 关闭连接池中的所有连接，已获取的客户端随之不可用
+func CloseAll() error {
+	lock.Lock()
+	conns := make([]*poolConn, 0, len(pool))
+	for k, pc := range pool {
+		delete(pool, k)
+		if !pc.closed {
+			pc.closed = true
+			conns = append(conns, pc)
+		}
+	}
+	lock.Unlock()
+	var errs []error
+	for _, pc := range conns {
+		if err := pc.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package couchbase
+
+import (
+	"errors"
+	"fmt"
+	gocbv2 "github.com/couchbase/gocb/v2"
+	"gopkg.in/couchbase/gocb.v1"
+	"time"
+)
+
+// Consistency N1QL 扫描一致性
+type Consistency int
+
+const (
+	// NotBounded 不等待索引更新，默认
+	NotBounded Consistency = iota
+	// RequestPlus 等待索引包含请求前的所有写入
+	RequestPlus
+)
+
+// ErrStopIteration QueryEach 回调返回该错误时提前结束遍历，QueryEach 返回 nil
+var ErrStopIteration = errors.New("couchbase: stop iteration")
+
+// QueryOptions N1QL 查询选项，nil 使用默认值
+type QueryOptions struct {
+	// Named 命名参数，语句中以 $name 引用，key 不带 $
+	Named map[string]interface{}
+	// Positional 位置参数，语句中以 $1、$2 引用；设置 Named 时忽略
+	Positional  []interface{}
+	Consistency Consistency
+	// Timeout 查询超时，0 使用 SDK 默认值
+	Timeout time.Duration
+	// ReadOnly 只读查询，禁止执行写语句
+	ReadOnly bool
+}
+
+// queryRows 查询结果行
+type queryRows interface {
+	// next 解码下一行，没有更多行或出错时返回 false
+	next(valuePtr interface{}) bool
+	// close 释放结果并返回遍历中的错误
+	close() error
+}
+
+// querier 支持 N1QL 查询的客户端
+type querier interface {
+	query(statement string, opts *QueryOptions) (queryRows, error)
+}
+
+// Query 执行查询并将所有行解码为 T
+//
+//	users, err := couchbase.Query[User](cb, "SELECT u.* FROM `app` u WHERE u.type = $type",
+//		&couchbase.QueryOptions{Named: map[string]interface{}{"type": "user"}})
+func Query[T any](c Client, statement string, opts *QueryOptions) ([]T, error) {
+	results := make([]T, 0)
+	err := QueryEach(c, statement, opts, func(row T) error {
+		results = append(results, row)
+		return nil
+	})
+	return results, err
+}
+
+// QueryEach 执行查询并逐行回调，fn 返回 ErrStopIteration 时提前结束
+func QueryEach[T any](c Client, statement string, opts *QueryOptions, fn func(row T) error) error {
+	q, ok := c.(querier)
+	if !ok {
+		return fmt.Errorf("couchbase: %T does not support query", c)
+	}
+	rows, err := q.query(statement, opts)
+	if err != nil {
+		return err
+	}
+	for {
+		var row T
+		if !rows.next(&row) {
+			break
+		}
+		if err = fn(row); err != nil {
+			_ = rows.close()
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	return rows.close()
+}
+
+// Exec 执行不需要返回行的语句，如 UPDATE、DELETE
+func Exec(c Client, statement string, opts *QueryOptions) error {
+	return QueryEach(c, statement, opts, func(row interface{}) error { return nil })
+}
+
+func (c *Cb) query(statement string, opts *QueryOptions) (queryRows, error) {
+	if opts == nil {
+		opts = &QueryOptions{}
+	}
+	q := gocb.NewN1qlQuery(statement).ReadOnly(opts.ReadOnly)
+	if opts.Consistency == RequestPlus {
+		q.Consistency(gocb.RequestPlus)
+	}
+	if opts.Timeout > 0 {
+		q.Timeout(opts.Timeout)
+	}
+	var params interface{}
+	if len(opts.Named) > 0 {
+		params = opts.Named
+	} else if len(opts.Positional) > 0 {
+		params = opts.Positional
+	}
+	res, err := c.ExecuteN1qlQuery(q, params)
+	if err != nil {
+		return nil, err
+	}
+	return v1Rows{res}, nil
+}
+
+type v1Rows struct {
+	gocb.QueryResults
+}
+
+func (r v1Rows) next(valuePtr interface{}) bool {
+	return r.Next(valuePtr)
+}
+
+func (r v1Rows) close() error {
+	return r.Close()
+}
+
+// EnsurePrimaryIndex 创建主索引，已存在时忽略
+func (c *Cb) EnsurePrimaryIndex() error {
+	return c.Manager("", "").CreatePrimaryIndex("", true, false)
+}
+
+// EnsureIndex 在 fields 上创建二级索引，已存在时忽略；fields 为字段名，如 "type"，
+// SDK 会为每个字段加反引号，不支持表达式或嵌套路径
+func (c *Cb) EnsureIndex(name string, fields []string) error {
+	return c.Manager("", "").CreateIndex(name, fields, true, false)
+}
+
+// isDefaultCollection 是否为默认 scope 下的默认集合
+func (c *CbV2) isDefaultCollection() bool {
+	return c.collection.ScopeName() == "_default" && c.collection.Name() == "_default"
+}
+
+func (c *CbV2) query(statement string, opts *QueryOptions) (queryRows, error) {
+	if opts == nil {
+		opts = &QueryOptions{}
+	}
+	qo := &gocbv2.QueryOptions{
+		Timeout:  opts.Timeout,
+		Readonly: opts.ReadOnly,
+	}
+	if opts.Consistency == RequestPlus {
+		qo.ScanConsistency = gocbv2.QueryScanConsistencyRequestPlus
+	}
+	if len(opts.Named) > 0 {
+		qo.NamedParameters = opts.Named
+	} else if len(opts.Positional) > 0 {
+		qo.PositionalParameters = opts.Positional
+	}
+	var (
+		res *gocbv2.QueryResult
+		err error
+	)
+	// 非默认 scope 时以 scope 为查询上下文，语句中可直接使用集合名
+	if scope := c.collection.ScopeName(); scope != "_default" {
+		res, err = c.bucket.Scope(scope).Query(statement, qo)
+	} else {
+		res, err = c.cluster.Query(statement, qo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v2Rows{res: res}, nil
+}
+
+type v2Rows struct {
+	res *gocbv2.QueryResult
+	err error
+}
+
+func (r *v2Rows) next(valuePtr interface{}) bool {
+	if r.err != nil || !r.res.Next() {
+		return false
+	}
+	r.err = r.res.Row(valuePtr)
+	return r.err == nil
+}
+
+func (r *v2Rows) close() error {
+	err := r.res.Close()
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
+
+// EnsurePrimaryIndex 在当前集合上创建主索引，已存在时忽略
+func (c *CbV2) EnsurePrimaryIndex() error {
+	if c.isDefaultCollection() {
+		return c.cluster.QueryIndexes().CreatePrimaryIndex(c.bucket.Name(),
+			&gocbv2.CreatePrimaryQueryIndexOptions{IgnoreIfExists: true})
+	}
+	return c.collection.QueryIndexes().CreatePrimaryIndex(
+		&gocbv2.CreatePrimaryQueryIndexOptions{IgnoreIfExists: true})
+}
+
+// EnsureIndex 在当前集合的 fields 上创建二级索引，已存在时忽略；fields 为字段名，SDK 会加反引号，不支持表达式
+func (c *CbV2) EnsureIndex(name string, fields []string) error {
+	if c.isDefaultCollection() {
+		return c.cluster.QueryIndexes().CreateIndex(c.bucket.Name(), name, fields,
+			&gocbv2.CreateQueryIndexOptions{IgnoreIfExists: true})
+	}
+	return c.collection.QueryIndexes().CreateIndex(name, fields,
+		&gocbv2.CreateQueryIndexOptions{IgnoreIfExists: true})
+}
@@ -0,0 +1,189 @@
+package couchbase
+
+import (
+	"fmt"
+	gocbv2 "github.com/couchbase/gocb/v2"
+	"sync"
+	"time"
+)
+
+// Client v1 Cb 和 v2 CbV2 的通用接口，迁移期间业务代码依赖该接口即可切换实现
+type Client interface {
+	Get(key string, rv interface{}) error
+	GetMulti(keys []string) ([]*multiValueType, error)
+	GetMultiMap(keys []string) ([]*multiValueMapType, error)
+	GetCas(key string, rv interface{}) (Cas, error)
+	Upsert(key string, value interface{}, opts *WriteOptions) (Cas, error)
+	Insert(key string, value interface{}, opts *WriteOptions) (Cas, error)
+	Replace(key string, value interface{}, opts *WriteOptions) (Cas, error)
+	Remove(key string, cas Cas) (Cas, error)
+	Touch(key string, expiry time.Duration) (Cas, error)
+	GetAndLock(key string, lockTime time.Duration, rv interface{}) (Cas, error)
+	Unlock(key string, cas Cas) error
+	Counter(key string, delta, initial int64, expiry time.Duration) (uint64, Cas, error)
+	EnsurePrimaryIndex() error
+	EnsureIndex(name string, fields []string) error
+	Close() error
+}
+
+var (
+	_ Client = (*Cb)(nil)
+	_ Client = (*CbV2)(nil)
+)
+
+// V2Config gocb v2 连接配置
+type V2Config struct {
+	// ConnStr 连接串，如 couchbase://127.0.0.1
+	ConnStr  string
+	Bucket   string
+	Username string
+	Password string
+	// Scope、Collection 为空时使用默认集合
+	Scope      string
+	Collection string
+	// ConnectTimeout 连接及等待 bucket 就绪的超时，默认 10s
+	ConnectTimeout time.Duration
+	// KVTimeout 单个 KV 操作超时，默认使用 SDK 默认值
+	KVTimeout time.Duration
+	// QueryTimeout N1QL 查询超时，默认使用 SDK 默认值
+	QueryTimeout time.Duration
+	// Durability 写操作的持久性级别，默认不要求
+	Durability gocbv2.DurabilityLevel
+}
+
+// CbV2 基于 gocb v2 的客户端，支持 scope/collection
+type CbV2 struct {
+	cluster    *gocbv2.Cluster
+	bucket     *gocbv2.Bucket
+	collection *gocbv2.Collection
+	durability gocbv2.DurabilityLevel
+	conn       *poolConn
+	closeOnce  sync.Once
+}
+
+// NewV2 创建 gocb v2 客户端，连接串、bucket、认证信息和超时设置都相同时共享连接
+func NewV2(cfg V2Config) (*CbV2, error) {
+	if cfg.ConnectTimeout == 0 {
+		cfg.ConnectTimeout = 10 * time.Second
+	}
+	poolKey := fmt.Sprintf("v2|%s|%s|%s|%s|%s|%s|%s", cfg.ConnStr, cfg.Bucket, cfg.Username,
+		secretHash(cfg.Password), cfg.ConnectTimeout, cfg.KVTimeout, cfg.QueryTimeout)
+	pc, err := acquire(poolKey, func() (*poolConn, error) {
+		return openV2(cfg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := &CbV2{cluster: pc.v2Cluster, bucket: pc.v2Bucket, durability: cfg.Durability, conn: pc}
+	c.collection = c.rawCollection(cfg.Scope, cfg.Collection)
+	return c, nil
+}
+
+// openV2 连接集群并等待 bucket 就绪
+func openV2(cfg V2Config) (*poolConn, error) {
+	opts := gocbv2.ClusterOptions{
+		TimeoutsConfig: gocbv2.TimeoutsConfig{
+			ConnectTimeout: cfg.ConnectTimeout,
+			KVTimeout:      cfg.KVTimeout,
+			QueryTimeout:   cfg.QueryTimeout,
+		},
+	}
+	if cfg.Username != "" {
+		opts.Authenticator = gocbv2.PasswordAuthenticator{Username: cfg.Username, Password: cfg.Password}
+	}
+	cluster, err := gocbv2.Connect(cfg.ConnStr, opts)
+	if err != nil {
+		return nil, err
+	}
+	bucket := cluster.Bucket(cfg.Bucket)
+	if err = bucket.WaitUntilReady(cfg.ConnectTimeout, nil); err != nil {
+		_ = cluster.Close(nil)
+		return nil, err
+	}
+	return &poolConn{v2Cluster: cluster, v2Bucket: bucket}, nil
+}
+
+// Cluster 底层 cluster
+func (c *CbV2) Cluster() *gocbv2.Cluster {
+	return c.cluster
+}
+
+// Bucket 底层 bucket
+func (c *CbV2) Bucket() *gocbv2.Bucket {
+	return c.bucket
+}
+
+// Raw 当前使用的底层集合
+func (c *CbV2) Raw() *gocbv2.Collection {
+	return c.collection
+}
+
+// Collection 返回操作指定 scope/collection 的客户端，与当前客户端共享连接，需要单独 Close；
+// scope 为空时使用 _default
+func (c *CbV2) Collection(scope, collection string) *CbV2 {
+	c.conn.retain()
+	return &CbV2{
+		cluster:    c.cluster,
+		bucket:     c.bucket,
+		collection: c.rawCollection(scope, collection),
+		durability: c.durability,
+		conn:       c.conn,
+	}
+}
+
+// rawCollection 底层集合，collection 为空时使用默认集合
+func (c *CbV2) rawCollection(scope, collection string) *gocbv2.Collection {
+	switch {
+	case collection == "":
+		return c.bucket.DefaultCollection()
+	case scope == "":
+		return c.bucket.DefaultScope().Collection(collection)
+	}
+	return c.bucket.Scope(scope).Collection(collection)
+}
+
+func (c *CbV2) Get(key string, rv interface{}) error {
+	res, err := c.collection.Get(key, nil)
+	if err != nil {
+		return err
+	}
+	return res.Content(rv)
+}
+
+// GetMulti 批量读取字符串值，按 keys 顺序返回，不存在的 key 被跳过
+func (c *CbV2) GetMulti(keys []string) ([]*multiValueType, error) {
+	return getMultiString(c, keys)
+}
+
+// GetMultiMap 批量读取 JSON 对象，按 keys 顺序返回，不存在的 key 被跳过
+func (c *CbV2) GetMultiMap(keys []string) ([]*multiValueMapType, error) {
+	return getMultiMap(c, keys)
+}
+
+// pingV2 检查 KV 服务是否可用
+func pingV2(bucket *gocbv2.Bucket) error {
+	res, err := bucket.Ping(&gocbv2.PingOptions{
+		ServiceTypes: []gocbv2.ServiceType{gocbv2.ServiceTypeKeyValue},
+		Timeout:      pingTimeout,
+	})
+	if err != nil {
+		return err
+	}
+	for _, reports := range res.Services {
+		for _, r := range reports {
+			if r.State != gocbv2.PingStateOk {
+				return fmt.Errorf("couchbase: ping %s failed: %s", r.Remote, r.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// Close 释放客户端，重复调用无效；共享连接在所有客户端都关闭后才断开
+func (c *CbV2) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.conn.release()
+	})
+	return err
+}
@@ -3,17 +3,15 @@ package goutil
 import (
 	"encoding/binary"
 	"errors"
+	"github.com/aidenliu/goutil/rand"
 	"github.com/idoubi/goz"
 	"github.com/neverlee/goyar"
-	"math/rand"
 	"net"
 	"os"
-	"strings"
-	"time"
 )
 
 type Unsigned interface {
-	~uint | ~uint8 | ~uint16 | ~int32 | ~int64 | ~uintptr
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
 }
 type Signed interface {
 	~int | ~int8 | ~int16 | ~int32 | ~int64
@@ -22,38 +20,34 @@ type Float interface {
 	~float32 | ~float64
 }
 
-// Substr 截取子字符串
+// Ordered 可比较大小的类型
+type Ordered interface {
+	Unsigned | Signed | Float | ~string
+}
+
+// Substr 按字符截取子字符串，offset 为 [start] 或 [start, end)，负数从末尾倒数，越界时截取到边界；
+// 需要 PHP substr 的 start/length 语义时使用 MbSubstr
 func Substr(str string, offset ...int) string {
-	if len(str) == 0 {
+	if len(str) == 0 || len(offset) == 0 {
 		return str
 	}
 	strR := []rune(str)
-	argLen := len(offset)
-	if argLen == 0 {
-		return str
-	}
-	var subStrR []rune
-	if argLen == 1 {
-		subStrR = strR[offset[0]:]
-	} else {
-		subStrR = strR[offset[0]:offset[1]]
-	}
-	return string(subStrR)
-}
-
-// StrPad 补全字符串
-func StrPad(str string, padLen int, padStr, padType string) string {
-	strLen := len(str)
-	lenDiff := padLen - strLen
-	if lenDiff <= 0 {
-		return str
+	n := len(strR)
+	start, _ := clampRange(n, offset[0])
+	end := n
+	if len(offset) > 1 {
+		end = offset[1]
+		if end < 0 {
+			end += n
+		}
+		if end > n {
+			end = n
+		}
 	}
-	if padType == "left" {
-		str = strings.Repeat(padStr, lenDiff) + str
-	} else {
-		str += strings.Repeat(padStr, lenDiff)
+	if end < start {
+		return ""
 	}
-	return str
+	return string(strR[start:end])
 }
 
 // InSlice 值是否在Slice里
@@ -66,9 +60,11 @@ func InSlice[T Unsigned | Signed | Float | string](value T, s []T) bool {
 	return false
 }
 
-// RandInt 生成随机整数
+// RandInt 生成 [0, n) 的随机整数，n <= 0 时返回 0，更多随机工具见 rand 包
 func RandInt(n int) int {
-	rand.Seed(time.Now().UnixNano())
+	if n <= 0 {
+		return 0
+	}
 	return rand.Intn(n)
 }
 
@@ -6,6 +6,9 @@ import (
 	"strings"
 )
 
+// ErrNotStored Add 时 key 已存在
+var ErrNotStored = memcache.ErrNotStored
+
 type Client struct {
 	c *memcache.Client
 }
@@ -33,6 +36,12 @@ func (m *Client) Set(key string, value []byte, expire int32) error {
 	return m.c.Set(&valueItem)
 }
 
+// Add 设置值，key 已存在时返回 ErrNotStored
+func (m *Client) Add(key string, value []byte, expire int32) error {
+	valueItem := memcache.Item{Key: key, Value: value, Expiration: expire}
+	return m.c.Add(&valueItem)
+}
+
 // Del 删除值
 func (m *Client) Del(key string) error {
 	return m.c.Delete(key)
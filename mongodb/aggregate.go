@@ -0,0 +1,201 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AggregateOptions = options.AggregateOptions
+
+// ErrStopIteration 迭代回调返回该错误时提前结束遍历，遍历函数返回 nil
+var ErrStopIteration = errors.New("mongodb: stop iteration")
+
+// Pipeline 聚合管道构造器
+//
+//	p := mongodb.NewPipeline().
+//		Match(bson.M{"status": 1}).
+//		Group("$uid", bson.M{"total": bson.M{"$sum": "$amount"}}).
+//		Sort(bson.D{{Key: "total", Value: -1}}).
+//		Limit(10)
+type Pipeline struct {
+	stages mongo.Pipeline
+}
+
+// NewPipeline 创建聚合管道构造器
+func NewPipeline() *Pipeline {
+	return &Pipeline{stages: mongo.Pipeline{}}
+}
+
+// Stage 追加任意阶段，如 Stage("$sample", bson.M{"size": 10})
+func (p *Pipeline) Stage(name string, value any) *Pipeline {
+	p.stages = append(p.stages, bson.D{{Key: name, Value: value}})
+	return p
+}
+
+// Match $match
+func (p *Pipeline) Match(filter any) *Pipeline {
+	return p.Stage("$match", filter)
+}
+
+// Group $group，id 为分组键，fields 为累加器字段
+func (p *Pipeline) Group(id any, fields bson.M) *Pipeline {
+	group := bson.M{"_id": id}
+	for k, v := range fields {
+		group[k] = v
+	}
+	return p.Stage("$group", group)
+}
+
+// Lookup $lookup 按字段关联
+func (p *Pipeline) Lookup(from, localField, foreignField, as string) *Pipeline {
+	return p.Stage("$lookup", bson.M{
+		"from":         from,
+		"localField":   localField,
+		"foreignField": foreignField,
+		"as":           as,
+	})
+}
+
+// LookupPipeline $lookup 使用子管道关联，let 定义子管道中可引用的变量
+func (p *Pipeline) LookupPipeline(from string, let bson.M, pipeline *Pipeline, as string) *Pipeline {
+	lookup := bson.M{"from": from, "pipeline": pipeline.Stages(), "as": as}
+	if len(let) > 0 {
+		lookup["let"] = let
+	}
+	return p.Stage("$lookup", lookup)
+}
+
+// Project $project
+func (p *Pipeline) Project(projection any) *Pipeline {
+	return p.Stage("$project", projection)
+}
+
+// AddFields $addFields
+func (p *Pipeline) AddFields(fields any) *Pipeline {
+	return p.Stage("$addFields", fields)
+}
+
+// Unwind $unwind，preserveEmpty 为 true 时保留空数组和缺失字段的文档
+func (p *Pipeline) Unwind(path string, preserveEmpty bool) *Pipeline {
+	if !preserveEmpty {
+		return p.Stage("$unwind", path)
+	}
+	return p.Stage("$unwind", bson.M{"path": path, "preserveNullAndEmptyArrays": true})
+}
+
+// Sort $sort
+func (p *Pipeline) Sort(sort bson.D) *Pipeline {
+	return p.Stage("$sort", sort)
+}
+
+// Skip $skip
+func (p *Pipeline) Skip(n int64) *Pipeline {
+	return p.Stage("$skip", n)
+}
+
+// Limit $limit
+func (p *Pipeline) Limit(n int64) *Pipeline {
+	return p.Stage("$limit", n)
+}
+
+// Count $count，结果写入 field 字段
+func (p *Pipeline) Count(field string) *Pipeline {
+	return p.Stage("$count", field)
+}
+
+// Facet $facet，每个子管道的结果写入同名字段
+func (p *Pipeline) Facet(facets map[string]*Pipeline) *Pipeline {
+	facet := bson.M{}
+	for name, sub := range facets {
+		facet[name] = sub.Stages()
+	}
+	return p.Stage("$facet", facet)
+}
+
+// Stages 管道各阶段，nil 时返回空管道
+func (p *Pipeline) Stages() mongo.Pipeline {
+	if p == nil || p.stages == nil {
+		return mongo.Pipeline{}
+	}
+	return p.stages
+}
+
+// pipelineStages *Pipeline 转为阶段列表，nil 视为空管道，其他类型原样使用
+func pipelineStages(pipeline any) any {
+	switch p := pipeline.(type) {
+	case nil:
+		return mongo.Pipeline{}
+	case *Pipeline:
+		return p.Stages()
+	}
+	return pipeline
+}
+
+// Aggregate 执行聚合，结果全部解码到 result，大结果集请使用 AggregateEach
+func (mgo *Mgo) Aggregate(database string, collection string, pipeline any, result any) error {
+	return mgo.AggregateContext(context.TODO(), database, collection, pipeline, result)
+}
+
+// AggregateContext pipeline 可为 *Pipeline、mongo.Pipeline 或 bson.A
+func (mgo *Mgo) AggregateContext(ctx context.Context, database string, collection string, pipeline any, result any, opts ...*AggregateOptions) error {
+	cursor, err := mgo.AggregateCursor(ctx, database, collection, pipeline, opts...)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, result)
+}
+
+// AggregateCursor 执行聚合并返回游标，调用方负责关闭
+func (mgo *Mgo) AggregateCursor(ctx context.Context, database string, collection string, pipeline any, opts ...*AggregateOptions) (*mongo.Cursor, error) {
+	return mgo.client().Database(database).Collection(collection).Aggregate(ctx, pipelineStages(pipeline), opts...)
+}
+
+// FindCursor 查询并返回游标，调用方负责关闭
+func (mgo *Mgo) FindCursor(ctx context.Context, database string, collection string, filter any, opts ...*FindOptions) (*mongo.Cursor, error) {
+	return mgo.client().Database(database).Collection(collection).Find(ctx, filter, opts...)
+}
+
+// Each 逐条解码游标中的文档并回调，遍历结束后关闭游标；
+// fn 返回 ErrStopIteration 时提前结束
+func Each[T any](ctx context.Context, cursor *mongo.Cursor, fn func(T) error) error {
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var item T
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// FindEach 流式遍历查询结果，不会一次性加载到内存
+//
+//	err := mongodb.FindEach(ctx, mgo, "db", "orders", bson.M{}, nil, func(o Order) error {
+//		return w.Write(o)
+//	})
+func FindEach[T any](ctx context.Context, mgo *Mgo, database string, collection string, filter any, opts *FindOptions, fn func(T) error) error {
+	cursor, err := mgo.FindCursor(ctx, database, collection, filter, opts)
+	if err != nil {
+		return err
+	}
+	return Each(ctx, cursor, fn)
+}
+
+// AggregateEach 流式遍历聚合结果
+func AggregateEach[T any](ctx context.Context, mgo *Mgo, database string, collection string, pipeline any, fn func(T) error) error {
+	cursor, err := mgo.AggregateCursor(ctx, database, collection, pipeline)
+	if err != nil {
+		return err
+	}
+	return Each(ctx, cursor, fn)
+}
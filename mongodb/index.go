@@ -0,0 +1,315 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IndexSpec 索引声明
+//
+//	mongodb.IndexSpec{Keys: bson.D{{Key: "uid", Value: 1}, {Key: "created_at", Value: -1}}}
+//	mongodb.IndexSpec{Keys: bson.D{{Key: "expire_at", Value: 1}}, TTL: time.Second}
+//	mongodb.IndexSpec{Keys: bson.D{{Key: "title", Value: "text"}}, Weights: bson.M{"title": 10}}
+type IndexSpec struct {
+	// Name 为空时按 MongoDB 默认规则生成，如 uid_1_created_at_-1
+	Name string
+	Keys bson.D
+	// Unique 唯一索引
+	Unique bool
+	// Sparse 稀疏索引
+	Sparse bool
+	// TTL 文档在索引字段时间之后多久过期，按秒取整，0 表示不过期
+	TTL time.Duration
+	// Partial 部分索引的过滤条件 partialFilterExpression
+	Partial any
+	// Weights 文本索引字段权重
+	Weights bson.M
+	// DefaultLanguage 文本索引默认语言
+	DefaultLanguage string
+}
+
+// CollectionSpec 集合声明，集合不存在时按选项创建
+type CollectionSpec struct {
+	Database   string
+	Collection string
+	Indexes    []IndexSpec
+	// Validator 文档校验规则，如 bson.M{"$jsonSchema": ...}，已存在的集合通过 collMod 更新
+	Validator any
+	// ValidationLevel off、strict、moderate
+	ValidationLevel string
+	// ValidationAction error、warn
+	ValidationAction string
+	// Capped 固定集合，SizeInBytes 必填，仅在创建时生效
+	Capped       bool
+	SizeInBytes  int64
+	MaxDocuments int64
+}
+
+// IndexReport 索引同步结果
+type IndexReport struct {
+	Database   string
+	Collection string
+	// Created 新建的索引
+	Created []string
+	// Extra 已存在但未声明的索引
+	Extra []string
+	// Dropped 已删除的索引
+	Dropped []string
+	// Conflicts 同名但定义不同的索引，dropExtra 时会删除后重建
+	Conflicts []string
+}
+
+var (
+	specMu sync.Mutex
+	specs  []CollectionSpec
+)
+
+// RegisterCollection 注册集合声明，由 EnsureRegistered 统一同步，通常在 init 中调用
+func RegisterCollection(spec CollectionSpec) {
+	specMu.Lock()
+	defer specMu.Unlock()
+	specs = append(specs, spec)
+}
+
+// EnsureRegistered 同步所有已注册的集合声明
+func (mgo *Mgo) EnsureRegistered(ctx context.Context, dropExtra bool) ([]IndexReport, error) {
+	specMu.Lock()
+	list := append([]CollectionSpec(nil), specs...)
+	specMu.Unlock()
+	reports := make([]IndexReport, 0, len(list))
+	for _, spec := range list {
+		report, err := mgo.EnsureCollection(ctx, spec, dropExtra)
+		reports = append(reports, report)
+		if err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
+
+// EnsureCollection 集合不存在时按选项创建，存在时更新校验规则，然后同步索引
+func (mgo *Mgo) EnsureCollection(ctx context.Context, spec CollectionSpec, dropExtra bool) (IndexReport, error) {
+	db := mgo.client().Database(spec.Database)
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": spec.Collection})
+	if err != nil {
+		return IndexReport{Database: spec.Database, Collection: spec.Collection}, err
+	}
+	if len(names) == 0 {
+		opts := options.CreateCollection()
+		if spec.Capped {
+			opts.SetCapped(true).SetSizeInBytes(spec.SizeInBytes)
+			if spec.MaxDocuments > 0 {
+				opts.SetMaxDocuments(spec.MaxDocuments)
+			}
+		}
+		if spec.Validator != nil {
+			opts.SetValidator(spec.Validator)
+		}
+		if spec.ValidationLevel != "" {
+			opts.SetValidationLevel(spec.ValidationLevel)
+		}
+		if spec.ValidationAction != "" {
+			opts.SetValidationAction(spec.ValidationAction)
+		}
+		err = db.CreateCollection(ctx, spec.Collection, opts)
+	} else if spec.Validator != nil || spec.ValidationLevel != "" || spec.ValidationAction != "" {
+		cmd := bson.D{{Key: "collMod", Value: spec.Collection}}
+		if spec.Validator != nil {
+			cmd = append(cmd, bson.E{Key: "validator", Value: spec.Validator})
+		}
+		if spec.ValidationLevel != "" {
+			cmd = append(cmd, bson.E{Key: "validationLevel", Value: spec.ValidationLevel})
+		}
+		if spec.ValidationAction != "" {
+			cmd = append(cmd, bson.E{Key: "validationAction", Value: spec.ValidationAction})
+		}
+		err = db.RunCommand(ctx, cmd).Err()
+	}
+	if err != nil {
+		return IndexReport{Database: spec.Database, Collection: spec.Collection}, err
+	}
+	return mgo.EnsureIndexes(ctx, spec.Database, spec.Collection, spec.Indexes, dropExtra)
+}
+
+// EnsureIndexes 对比已有索引，创建缺失的索引；
+// dropExtra 为 true 时删除未声明的索引并重建定义不同的同名索引，否则只在报告中列出
+func (mgo *Mgo) EnsureIndexes(ctx context.Context, database, collection string, indexes []IndexSpec, dropExtra bool) (IndexReport, error) {
+	report := IndexReport{Database: database, Collection: collection}
+	view := mgo.client().Database(database).Collection(collection).Indexes()
+	cursor, err := view.List(ctx)
+	if err != nil {
+		return report, err
+	}
+	var existing []bson.M
+	if err = cursor.All(ctx, &existing); err != nil {
+		return report, err
+	}
+	current := make(map[string]bson.M, len(existing))
+	for _, idx := range existing {
+		if name, ok := idx["name"].(string); ok {
+			current[name] = idx
+		}
+	}
+
+	declared := make(map[string]bool, len(indexes))
+	var models []mongo.IndexModel
+	for _, spec := range indexes {
+		name := spec.name()
+		declared[name] = true
+		if idx, ok := current[name]; ok {
+			if spec.matches(idx) {
+				continue
+			}
+			report.Conflicts = append(report.Conflicts, name)
+			if !dropExtra {
+				continue
+			}
+			if _, err = view.DropOne(ctx, name); err != nil {
+				return report, fmt.Errorf("drop index %s: %w", name, err)
+			}
+			report.Dropped = append(report.Dropped, name)
+		}
+		models = append(models, spec.model())
+		report.Created = append(report.Created, name)
+	}
+
+	for name := range current {
+		if name == "_id_" || declared[name] {
+			continue
+		}
+		report.Extra = append(report.Extra, name)
+		if dropExtra {
+			if _, err = view.DropOne(ctx, name); err != nil {
+				return report, fmt.Errorf("drop index %s: %w", name, err)
+			}
+			report.Dropped = append(report.Dropped, name)
+		}
+	}
+
+	if len(models) > 0 {
+		if _, err = view.CreateMany(ctx, models); err != nil {
+			report.Created = nil
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// name 索引名，未指定时按 MongoDB 默认规则生成
+func (spec IndexSpec) name() string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+	parts := make([]string, 0, len(spec.Keys)*2)
+	for _, k := range spec.Keys {
+		parts = append(parts, k.Key, fmt.Sprint(k.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// isText 是否为文本索引
+func (spec IndexSpec) isText() bool {
+	for _, k := range spec.Keys {
+		if k.Value == "text" {
+			return true
+		}
+	}
+	return false
+}
+
+// model 转换为驱动的索引模型
+func (spec IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(spec.name())
+	if spec.Unique {
+		opts.SetUnique(true)
+	}
+	if spec.Sparse {
+		opts.SetSparse(true)
+	}
+	if spec.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(spec.TTL / time.Second))
+	}
+	if spec.Partial != nil {
+		opts.SetPartialFilterExpression(spec.Partial)
+	}
+	if len(spec.Weights) > 0 {
+		opts.SetWeights(spec.Weights)
+	}
+	if spec.DefaultLanguage != "" {
+		opts.SetDefaultLanguage(spec.DefaultLanguage)
+	}
+	return mongo.IndexModel{Keys: spec.Keys, Options: opts}
+}
+
+// matches 与已有索引的定义是否一致；文本索引的键在服务端会被改写，只比较选项，
+// 部分索引只比较是否设置了过滤条件
+func (spec IndexSpec) matches(idx bson.M) bool {
+	if !spec.isText() {
+		key, ok := idx["key"].(bson.M)
+		if !ok || len(key) != len(spec.Keys) {
+			return false
+		}
+		for _, k := range spec.Keys {
+			if !sameKeyValue(key[k.Key], k.Value) {
+				return false
+			}
+		}
+	}
+	if boolField(idx, "unique") != spec.Unique || boolField(idx, "sparse") != spec.Sparse {
+		return false
+	}
+	ttl, hasTTL := numberField(idx, "expireAfterSeconds")
+	if hasTTL != (spec.TTL > 0) || (hasTTL && ttl != int64(spec.TTL/time.Second)) {
+		return false
+	}
+	_, hasPartial := idx["partialFilterExpression"]
+	return hasPartial == (spec.Partial != nil)
+}
+
+// sameKeyValue 比较索引方向，数字类型不同但值相同视为一致
+func sameKeyValue(existing, declared any) bool {
+	a, aok := toInt64(existing)
+	b, bok := toInt64(declared)
+	if aok && bok {
+		return a == b
+	}
+	return fmt.Sprint(existing) == fmt.Sprint(declared)
+}
+
+func boolField(m bson.M, key string) bool {
+	b, _ := m[key].(bool)
+	return b
+}
+
+func numberField(m bson.M, key string) (int64, bool) {
+	v, ok := m[key]
+	if !ok {
+		return 0, false
+	}
+	return toInt64(v)
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// IsDuplicateKey 是否为唯一索引冲突错误
+func IsDuplicateKey(err error) bool {
+	return mongo.IsDuplicateKeyError(err)
+}
@@ -2,66 +2,398 @@ package mongodb
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/aidenliu/goutil/config"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"log"
+	"strings"
+	"sync"
 	"time"
 )
 
+// MConfig 连接配置，设置 ConfigKey 时从 service.yaml 同名配置读取，配置文件中的项覆盖代码中的值：
+//
+//	mongo:
+//	  host: mongodb://127.0.0.1:27017
+//	  maxPoolSize: 100
+//	  readPreference: secondaryPreferred
+//	  writeConcern: majority
+//	  compressors: zstd,snappy
 type MConfig struct {
+	// ConfigKey service.yaml 配置名，ConfigKey 及其余配置都相同的 New 共享同一个客户端
 	ConfigKey        string
 	Host             string
 	ConnectTimeout   time.Duration
 	PingTimeInterval time.Duration
+	// ReconnectFailures 连续 ping 失败达到该次数时重建客户端，
+	// 默认 0 不重建，依赖驱动自身的服务器监控自动恢复连接
+	ReconnectFailures int
+	// DisableMonitor 不启动健康检查协程，Health 只反映创建时的状态
+	DisableMonitor bool
+
+	// AppName 在服务端日志和 currentOp 中显示的应用名
+	AppName                string
+	MaxPoolSize            uint64
+	MinPoolSize            uint64
+	MaxConnIdleTime        time.Duration
+	ServerSelectionTimeout time.Duration
+	// ReadPreference primary、primaryPreferred、secondary、secondaryPreferred、nearest
+	ReadPreference string
+	// ReadConcern local、majority、linearizable、available、snapshot
+	ReadConcern string
+	// WriteConcern majority、节点数或 tag 名
+	WriteConcern string
+	RetryWrites  *bool
+	RetryReads   *bool
+	// Compressors snappy、zlib、zstd
+	Compressors []string
+	// Username 为空时使用连接串中的认证信息
+	Username   string
+	Password   string
+	AuthSource string
+	// TLSCAFile CA 证书文件
+	TLSCAFile string
+	// TLSCertKeyFile 客户端证书和私钥的 PEM 文件
+	TLSCertKeyFile string
+	TLSInsecure    bool
 }
 
+// Mgo 客户端句柄，ConfigKey 及配置相同的 New 共享底层连接，每个句柄各自 Close 一次
 type Mgo struct {
-	*mongo.Client
+	conn      *mgoConn
+	closeOnce sync.Once
+}
+
+// mgoConn 底层连接，后台重建客户端时通过 mu 替换 cli，所有访问都经过 client
+type mgoConn struct {
+	mu      sync.RWMutex
+	cli     *mongo.Client
+	health  Health
+	connect func() (*mongo.Client, error)
+	timeout time.Duration
+	stop    chan struct{}
+	done    chan struct{}
+	// key 共享连接在 conns 中的 key，refs 为引用计数
+	key  string
+	refs int
+}
+
+// Health 连接健康状态，可用于就绪探针
+type Health struct {
+	// Healthy 最近一次 ping 是否成功
+	Healthy bool
+	// LastPing 最近一次 ping 的时间
+	LastPing time.Time
+	// Latency 最近一次 ping 的耗时
+	Latency time.Duration
+	// LastError 最近一次 ping 的错误，成功时为 nil
+	LastError error
+	// Failures 连续失败次数
+	Failures int
+	// Reconnects 重建客户端的次数
+	Reconnects int
 }
 
 type FindOptions = options.FindOptions
 type InsertOneResult = mongo.InsertOneResult
 type UpdateResult = mongo.UpdateResult
 type DeleteResult = mongo.DeleteResult
+type UpdateOptions = options.UpdateOptions
+type FindOneAndUpdateOptions = options.FindOneAndUpdateOptions
+type ReplaceOptions = options.ReplaceOptions
+type InsertManyOptions = options.InsertManyOptions
+type InsertManyResult = mongo.InsertManyResult
+type BulkWriteOptions = options.BulkWriteOptions
+type BulkWriteResult = mongo.BulkWriteResult
+type WriteModel = mongo.WriteModel
+
+// FindOneAndUpdate 返回更新前或更新后的文档
+const (
+	ReturnBefore = options.Before
+	ReturnAfter  = options.After
+)
+
+// 旧客户端被替换后延迟断开，等待进行中的请求完成
+const disconnectDelay = time.Minute
 
+var (
+	connsMu sync.Mutex
+	conns   = make(map[string]*mgoConn)
+	// connecting 正在创建的共享连接，相同配置的并发 New 等待同一次连接
+	connecting = make(map[string]*pendingConn)
+)
+
+// pendingConn 正在创建的共享连接，done 关闭后 err 可读
+type pendingConn struct {
+	done chan struct{}
+	err  error
+}
+
+// New 创建客户端，ConfigKey 及配置相同时共享已创建的连接，每次 New 返回的句柄需对应一次 Close
 func New(mc MConfig) (*Mgo, error) {
-	var uri string
-	if mc.ConfigKey != "" {
+	if mc.ConfigKey == "" {
+		conn, err := newConn(mc)
+		if err != nil {
+			return nil, err
+		}
+		return &Mgo{conn: conn}, nil
+	}
+	// 代码中的配置不同时使用独立的连接
+	fingerprint, err := json.Marshal(mc)
+	if err != nil {
+		return nil, err
+	}
+	key := string(fingerprint)
+	for {
+		connsMu.Lock()
+		if conn, ok := conns[key]; ok {
+			conn.refs++
+			connsMu.Unlock()
+			return &Mgo{conn: conn}, nil
+		}
+		// 同一配置正在连接时等待其完成后重新检查，不在持有锁时连接
+		if p, ok := connecting[key]; ok {
+			connsMu.Unlock()
+			<-p.done
+			if p.err != nil {
+				return nil, p.err
+			}
+			continue
+		}
+		p := &pendingConn{done: make(chan struct{})}
+		connecting[key] = p
+		connsMu.Unlock()
+
+		conn, err := newSharedConn(mc)
+		connsMu.Lock()
+		delete(connecting, key)
+		if err == nil {
+			conn.key = key
+			conn.refs = 1
+			conns[key] = conn
+		}
+		p.err = err
+		close(p.done)
+		connsMu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return &Mgo{conn: conn}, nil
+	}
+}
+
+// newSharedConn 读取 ConfigKey 对应的配置并连接
+func newSharedConn(mc MConfig) (*mgoConn, error) {
+	if err := config.ServiceDecode(mc.ConfigKey, &mc); err != nil {
+		// 只有配置项不存在时才回退到只读取 host 的旧配置方式
+		if !errors.Is(err, config.ErrServiceNotFound) {
+			return nil, fmt.Errorf("mongodb configKey %s: %w", mc.ConfigKey, err)
+		}
 		mConfig := config.Service(mc.ConfigKey)
-		uri = mConfig["host"]
-	} else {
-		uri = mc.Host
+		if mConfig == nil {
+			return nil, fmt.Errorf("mongodb configKey %s: %w", mc.ConfigKey, err)
+		}
+		mc.Host = mConfig["host"]
 	}
+	return newConn(mc)
+}
+
+// newConn 连接并启动健康检查
+func newConn(mc MConfig) (*mgoConn, error) {
 	if mc.ConnectTimeout == 0 {
 		mc.ConnectTimeout = time.Second * 3
 	}
 	if mc.PingTimeInterval == 0 {
 		mc.PingTimeInterval = time.Second * 3
 	}
-	mgo := new(Mgo)
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri).SetTimeout(mc.ConnectTimeout))
+	opts, err := clientOptions(mc)
+	if err != nil {
+		return nil, err
+	}
+	c := &mgoConn{
+		timeout: mc.ConnectTimeout,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	c.connect = func() (*mongo.Client, error) {
+		return mongo.Connect(context.TODO(), opts)
+	}
+	client, err := c.connect()
 	if err != nil {
 		log.Println("mongo connect err:", err)
 		return nil, err
 	}
-	if err := client.Ping(context.TODO(), readpref.Primary()); err != nil {
+	c.cli = client
+	if err := c.ping(); err != nil {
+		_ = client.Disconnect(context.TODO())
 		return nil, err
 	}
-	mgo.Client = client
-	go func() {
-		for {
-			if err := mgo.Client.Ping(context.TODO(), readpref.Primary()); err != nil {
-				mgo.Client, _ = mongo.Connect(context.TODO(), options.Client().ApplyURI(uri).SetTimeout(mc.ConnectTimeout))
-				log.Println("mongoDB collect ping failure", err)
-			}
-			time.Sleep(mc.PingTimeInterval)
+	if mc.DisableMonitor {
+		close(c.done)
+	} else {
+		go c.monitor(mc.PingTimeInterval, mc.ReconnectFailures)
+	}
+	return c, nil
+}
+
+// CurrentClient 当前使用的客户端，后台重建客户端时可安全并发调用
+func (mgo *Mgo) CurrentClient() *mongo.Client {
+	return mgo.conn.client()
+}
+
+// client 内部统一通过该方法获取客户端
+func (mgo *Mgo) client() *mongo.Client {
+	return mgo.conn.client()
+}
+
+// Database 当前客户端的数据库
+func (mgo *Mgo) Database(name string, opts ...*options.DatabaseOptions) *mongo.Database {
+	return mgo.client().Database(name, opts...)
+}
+
+// StartSession 在当前客户端上开启会话
+func (mgo *Mgo) StartSession(opts ...*options.SessionOptions) (mongo.Session, error) {
+	return mgo.client().StartSession(opts...)
+}
+
+// UseSession 在当前客户端上开启会话并执行 fn
+func (mgo *Mgo) UseSession(ctx context.Context, fn func(mongo.SessionContext) error) error {
+	return mgo.client().UseSession(ctx, fn)
+}
+
+// UseSessionWithOptions 在当前客户端上按 opts 开启会话并执行 fn
+func (mgo *Mgo) UseSessionWithOptions(ctx context.Context, opts *options.SessionOptions, fn func(mongo.SessionContext) error) error {
+	return mgo.client().UseSessionWithOptions(ctx, opts, fn)
+}
+
+// ListDatabaseNames 数据库名列表
+func (mgo *Mgo) ListDatabaseNames(ctx context.Context, filter any, opts ...*options.ListDatabasesOptions) ([]string, error) {
+	return mgo.client().ListDatabaseNames(ctx, filter, opts...)
+}
+
+// Health 最近一次健康检查的结果
+func (mgo *Mgo) Health() Health {
+	return mgo.conn.getHealth()
+}
+
+// Close 关闭句柄，重复调用无效；共享连接在最后一个句柄关闭时才停止健康检查并断开
+func (mgo *Mgo) Close(ctx context.Context) error {
+	var err error
+	mgo.closeOnce.Do(func() {
+		err = mgo.conn.release(ctx)
+	})
+	return err
+}
+
+// client 当前客户端
+func (c *mgoConn) client() *mongo.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cli
+}
+
+// getHealth 最近一次健康检查的结果
+func (c *mgoConn) getHealth() Health {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.health
+}
+
+// ping 检查主节点连通性并记录健康状态
+func (c *mgoConn) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.client().Ping(ctx, readpref.Primary())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.health.Healthy = err == nil
+	c.health.LastPing = start
+	c.health.Latency = time.Since(start)
+	c.health.LastError = err
+	if err != nil {
+		c.health.Failures++
+	} else {
+		c.health.Failures = 0
+	}
+	return err
+}
+
+// monitor 定时 ping，连续失败达到 reconnectFailures 次时重建客户端
+func (c *mgoConn) monitor(interval time.Duration, reconnectFailures int) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+		err := c.ping()
+		if err == nil {
+			continue
+		}
+		log.Println("mongoDB ping failure", err)
+		if reconnectFailures <= 0 || c.getHealth().Failures < reconnectFailures {
+			continue
+		}
+		c.reconnect()
+	}
+}
+
+// reconnect 建立新客户端并替换，旧客户端延迟断开
+func (c *mgoConn) reconnect() {
+	client, err := c.connect()
+	if err != nil {
+		log.Println("mongoDB reconnect failure", err)
+		return
+	}
+	c.mu.Lock()
+	select {
+	case <-c.stop:
+		// 已关闭，放弃替换
+		c.mu.Unlock()
+		_ = client.Disconnect(context.TODO())
+		return
+	default:
+	}
+	old := c.cli
+	c.cli = client
+	c.health.Failures = 0
+	c.health.Reconnects++
+	c.mu.Unlock()
+	time.AfterFunc(disconnectDelay, func() {
+		_ = old.Disconnect(context.TODO())
+	})
+}
+
+// release 释放一个引用，最后一个引用释放时停止健康检查并断开客户端
+func (c *mgoConn) release(ctx context.Context) error {
+	if c.key != "" {
+		connsMu.Lock()
+		c.refs--
+		if c.refs > 0 {
+			connsMu.Unlock()
+			return nil
+		}
+		if conns[c.key] == c {
+			delete(conns, c.key)
 		}
-	}()
-	return mgo, nil
+		connsMu.Unlock()
+	}
+	close(c.stop)
+	<-c.done
+	err := c.client().Disconnect(ctx)
+	c.mu.Lock()
+	c.health.Healthy = false
+	c.mu.Unlock()
+	return err
 }
 
 func (mgo *Mgo) IsNotFound(err error) bool {
@@ -69,52 +401,164 @@ func (mgo *Mgo) IsNotFound(err error) bool {
 }
 
 func (mgo *Mgo) Count(database string, collection string, filter any) int64 {
-	count, _ := mgo.Database(database).Collection(collection).CountDocuments(context.TODO(), filter, nil)
+	count, _ := mgo.CountContext(context.TODO(), database, collection, filter)
 	return count
 }
 
+// CountContext 统计文档数，返回查询错误
+func (mgo *Mgo) CountContext(ctx context.Context, database string, collection string, filter any) (int64, error) {
+	return mgo.client().Database(database).Collection(collection).CountDocuments(ctx, filter)
+}
+
 func (mgo *Mgo) FindOne(database string, collection string, filter any, result any) error {
-	return mgo.Database(database).Collection(collection).FindOne(context.TODO(), filter).Decode(result)
+	return mgo.FindOneContext(context.TODO(), database, collection, filter, result)
+}
+
+func (mgo *Mgo) FindOneContext(ctx context.Context, database string, collection string, filter any, result any) error {
+	return mgo.client().Database(database).Collection(collection).FindOne(ctx, filter).Decode(result)
 }
 
 func (mgo *Mgo) Find(database string, collection string, filter any, result any, opts *FindOptions) error {
-	cursor, err := mgo.Database(database).Collection(collection).Find(context.TODO(), filter, opts)
+	return mgo.FindContext(context.TODO(), database, collection, filter, result, opts)
+}
+
+func (mgo *Mgo) FindContext(ctx context.Context, database string, collection string, filter any, result any, opts *FindOptions) error {
+	cursor, err := mgo.client().Database(database).Collection(collection).Find(ctx, filter, opts)
 	if err == nil {
-		defer cursor.Close(context.TODO())
-		return cursor.All(context.TODO(), result)
+		defer cursor.Close(ctx)
+		return cursor.All(ctx, result)
 	}
 	return err
 }
 
 func (mgo *Mgo) InsertOne(database string, collection string, document any) (*InsertOneResult, error) {
-	return mgo.Database(database).Collection(collection).InsertOne(context.TODO(), document)
+	return mgo.InsertOneContext(context.TODO(), database, collection, document)
+}
+
+func (mgo *Mgo) InsertOneContext(ctx context.Context, database string, collection string, document any) (*InsertOneResult, error) {
+	return mgo.client().Database(database).Collection(collection).InsertOne(ctx, document)
 }
 
+// updateDocument 转换更新参数：*Update、操作符文档和聚合管道原样使用，
+// 其他数据包装为 $set
+func updateDocument(data any) any {
+	switch d := data.(type) {
+	case *Update:
+		return d.Document()
+	case Update:
+		return d.Document()
+	case mongo.Pipeline, bson.A, []bson.D, []bson.M, []any:
+		return d
+	case bson.M:
+		if isOperatorDocument(d) {
+			return d
+		}
+	case map[string]any:
+		if isOperatorDocument(d) {
+			return d
+		}
+	case bson.D:
+		if len(d) > 0 && strings.HasPrefix(d[0].Key, "$") {
+			return d
+		}
+	}
+	return bson.M{"$set": data}
+}
+
+// isOperatorDocument 所有键都以 $ 开头
+func isOperatorDocument(m map[string]any) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateOne data 为 *Update、操作符文档或聚合管道时原样执行，其他数据按 $set 更新
 func (mgo *Mgo) UpdateOne(database string, collection string, filter any, data any) (*UpdateResult, error) {
-	return mgo.Database(database).Collection(collection).UpdateOne(context.TODO(), filter, bson.M{"$set": data})
+	return mgo.UpdateOneContext(context.TODO(), database, collection, filter, data)
+}
+
+func (mgo *Mgo) UpdateOneContext(ctx context.Context, database string, collection string, filter any, data any, opts ...*UpdateOptions) (*UpdateResult, error) {
+	return mgo.client().Database(database).Collection(collection).UpdateOne(ctx, filter, updateDocument(data), opts...)
 }
 
 func (mgo *Mgo) Upsert(database string, collection string, filter any, data any) (*UpdateResult, error) {
-	opts := options.Update().SetUpsert(true)
-	return mgo.Database(database).Collection(collection).UpdateOne(context.TODO(), filter, bson.M{"$set": data}, opts)
+	return mgo.UpsertContext(context.TODO(), database, collection, filter, data)
+}
+
+func (mgo *Mgo) UpsertContext(ctx context.Context, database string, collection string, filter any, data any, opts ...*UpdateOptions) (*UpdateResult, error) {
+	opts = append(opts, options.Update().SetUpsert(true))
+	return mgo.client().Database(database).Collection(collection).UpdateOne(ctx, filter, updateDocument(data), opts...)
 }
 
 func (mgo *Mgo) UpdateMany(database string, collection string, filter any, data any) (*UpdateResult, error) {
-	return mgo.Database(database).Collection(collection).UpdateMany(context.TODO(), filter, bson.M{"$set": data})
+	return mgo.UpdateManyContext(context.TODO(), database, collection, filter, data)
+}
+
+func (mgo *Mgo) UpdateManyContext(ctx context.Context, database string, collection string, filter any, data any, opts ...*UpdateOptions) (*UpdateResult, error) {
+	return mgo.client().Database(database).Collection(collection).UpdateMany(ctx, filter, updateDocument(data), opts...)
 }
 
+// FindOneAndUpdate 默认返回更新前的文档，可通过 FindOneAndUpdateContext 的
+// options.FindOneAndUpdate().SetReturnDocument(ReturnAfter) 返回更新后的文档
 func (mgo *Mgo) FindOneAndUpdate(database string, collection string, filter any, data any, result any) error {
-	r := mgo.Database(database).Collection(collection).FindOneAndUpdate(context.TODO(), filter, bson.M{"$set": data})
+	return mgo.FindOneAndUpdateContext(context.TODO(), database, collection, filter, data, result)
+}
+
+// FindOneAndUpdateContext opts 可设置 ReturnDocument、Projection、Sort、Upsert、ArrayFilters
+func (mgo *Mgo) FindOneAndUpdateContext(ctx context.Context, database string, collection string, filter any, data any, result any, opts ...*FindOneAndUpdateOptions) error {
+	r := mgo.client().Database(database).Collection(collection).FindOneAndUpdate(ctx, filter, updateDocument(data), opts...)
 	if r.Err() != nil {
 		return r.Err()
 	}
 	return r.Decode(result)
 }
 
+// ReplaceOne 整体替换单个文档
+func (mgo *Mgo) ReplaceOne(database string, collection string, filter any, replacement any) (*UpdateResult, error) {
+	return mgo.ReplaceOneContext(context.TODO(), database, collection, filter, replacement)
+}
+
+func (mgo *Mgo) ReplaceOneContext(ctx context.Context, database string, collection string, filter any, replacement any, opts ...*ReplaceOptions) (*UpdateResult, error) {
+	return mgo.client().Database(database).Collection(collection).ReplaceOne(ctx, filter, replacement, opts...)
+}
+
+// InsertMany 批量插入
+func (mgo *Mgo) InsertMany(database string, collection string, documents []any) (*InsertManyResult, error) {
+	return mgo.InsertManyContext(context.TODO(), database, collection, documents)
+}
+
+func (mgo *Mgo) InsertManyContext(ctx context.Context, database string, collection string, documents []any, opts ...*InsertManyOptions) (*InsertManyResult, error) {
+	return mgo.client().Database(database).Collection(collection).InsertMany(ctx, documents, opts...)
+}
+
+// BulkWrite 批量写入，models 可由 mongo.NewUpdateOneModel 等创建，
+// 更新文档可使用 Update.Document()
+func (mgo *Mgo) BulkWrite(database string, collection string, models []WriteModel) (*BulkWriteResult, error) {
+	return mgo.BulkWriteContext(context.TODO(), database, collection, models)
+}
+
+func (mgo *Mgo) BulkWriteContext(ctx context.Context, database string, collection string, models []WriteModel, opts ...*BulkWriteOptions) (*BulkWriteResult, error) {
+	return mgo.client().Database(database).Collection(collection).BulkWrite(ctx, models, opts...)
+}
+
 func (mgo *Mgo) DeleteOne(database, collection string, filter any) (*DeleteResult, error) {
-	return mgo.Database(database).Collection(collection).DeleteOne(context.TODO(), filter)
+	return mgo.DeleteOneContext(context.TODO(), database, collection, filter)
+}
+
+func (mgo *Mgo) DeleteOneContext(ctx context.Context, database, collection string, filter any) (*DeleteResult, error) {
+	return mgo.client().Database(database).Collection(collection).DeleteOne(ctx, filter)
 }
 
 func (mgo *Mgo) DeleteMany(database, collection string, filter any) (*DeleteResult, error) {
-	return mgo.Database(database).Collection(collection).DeleteMany(context.TODO(), filter)
+	return mgo.DeleteManyContext(context.TODO(), database, collection, filter)
+}
+
+func (mgo *Mgo) DeleteManyContext(ctx context.Context, database, collection string, filter any) (*DeleteResult, error) {
+	return mgo.client().Database(database).Collection(collection).DeleteMany(ctx, filter)
 }
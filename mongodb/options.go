@@ -0,0 +1,104 @@
+package mongodb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"os"
+	"strconv"
+)
+
+// clientOptions 根据配置生成客户端选项，未设置的项使用连接串或驱动默认值
+func clientOptions(mc MConfig) (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(mc.Host).SetTimeout(mc.ConnectTimeout)
+	if mc.AppName != "" {
+		opts.SetAppName(mc.AppName)
+	}
+	if mc.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(mc.MaxPoolSize)
+	}
+	if mc.MinPoolSize > 0 {
+		opts.SetMinPoolSize(mc.MinPoolSize)
+	}
+	if mc.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(mc.MaxConnIdleTime)
+	}
+	if mc.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(mc.ServerSelectionTimeout)
+	}
+	if mc.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(mc.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadPreference(rp)
+	}
+	if mc.ReadConcern != "" {
+		opts.SetReadConcern(&readconcern.ReadConcern{Level: mc.ReadConcern})
+	}
+	if mc.WriteConcern != "" {
+		wc := &writeconcern.WriteConcern{W: mc.WriteConcern}
+		if n, err := strconv.Atoi(mc.WriteConcern); err == nil {
+			wc.W = n
+		}
+		opts.SetWriteConcern(wc)
+	}
+	if mc.RetryWrites != nil {
+		opts.SetRetryWrites(*mc.RetryWrites)
+	}
+	if mc.RetryReads != nil {
+		opts.SetRetryReads(*mc.RetryReads)
+	}
+	if len(mc.Compressors) > 0 {
+		opts.SetCompressors(mc.Compressors)
+	}
+	if mc.Username != "" {
+		opts.SetAuth(options.Credential{
+			AuthSource: mc.AuthSource,
+			Username:   mc.Username,
+			Password:   mc.Password,
+		})
+	} else if mc.AuthSource != "" && opts.Auth != nil {
+		opts.Auth.AuthSource = mc.AuthSource
+	}
+	if mc.TLSCAFile != "" || mc.TLSCertKeyFile != "" || mc.TLSInsecure {
+		tc, err := tlsConfig(mc)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tc)
+	}
+	return opts, opts.Validate()
+}
+
+// tlsConfig 加载 CA 证书和客户端证书，TLSCertKeyFile 为同时包含证书和私钥的 PEM 文件
+func tlsConfig(mc MConfig) (*tls.Config, error) {
+	tc := &tls.Config{InsecureSkipVerify: mc.TLSInsecure}
+	if mc.TLSCAFile != "" {
+		pem, err := os.ReadFile(mc.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("mongodb: no certificate found in %s", mc.TLSCAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if mc.TLSCertKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(mc.TLSCertKeyFile, mc.TLSCertKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
@@ -0,0 +1,366 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// 自动维护的字段
+const (
+	FieldCreatedAt = "created_at"
+	FieldUpdatedAt = "updated_at"
+	FieldDeletedAt = "deleted_at"
+)
+
+// Model 可嵌入文档结构体的通用字段，嵌入时必须声明 inline，否则会编码为嵌套的 model 子文档：
+//
+//	type User struct {
+//		mongodb.Model `bson:",inline"`
+//		Name string  `bson:"name"`
+//	}
+type Model struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CreatedAt time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+	DeletedAt *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+}
+
+// Page 分页参数
+type Page struct {
+	Skip  int64
+	Limit int64
+	Sort  bson.D
+}
+
+// options 转换为查询选项
+func (page Page) options() *options.FindOptions {
+	opts := options.Find()
+	if page.Skip > 0 {
+		opts.SetSkip(page.Skip)
+	}
+	if page.Limit > 0 {
+		opts.SetLimit(page.Limit)
+	}
+	if len(page.Sort) > 0 {
+		opts.SetSort(page.Sort)
+	}
+	return opts
+}
+
+// Repo 绑定 database/collection 的泛型仓储，默认自动维护 created_at/updated_at
+type Repo[T any] struct {
+	mgo        *Mgo
+	database   string
+	collection string
+	// Timestamps 插入时设置 created_at/updated_at，更新时设置 updated_at
+	Timestamps bool
+	// SoftDelete 删除时设置 deleted_at，查询时排除已删除的文档
+	SoftDelete bool
+}
+
+// NewRepo 创建仓储
+func NewRepo[T any](mgo *Mgo, database, collection string) *Repo[T] {
+	return &Repo[T]{mgo: mgo, database: database, collection: collection, Timestamps: true}
+}
+
+// Collection 底层集合
+func (r *Repo[T]) Collection() *mongo.Collection {
+	return r.mgo.client().Database(r.database).Collection(r.collection)
+}
+
+// filter 处理空条件，启用软删除时排除已删除文档
+func (r *Repo[T]) filter(filter any) any {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	if !r.SoftDelete {
+		return filter
+	}
+	return bson.M{"$and": bson.A{filter, bson.M{FieldDeletedAt: nil}}}
+}
+
+// FindByID 按 _id 查询
+func (r *Repo[T]) FindByID(ctx context.Context, id any) (*T, error) {
+	return r.FindOne(ctx, bson.M{"_id": id})
+}
+
+// FindOne 查询单个文档，未找到时返回 mongo.ErrNoDocuments
+func (r *Repo[T]) FindOne(ctx context.Context, filter any) (*T, error) {
+	result := new(T)
+	if err := r.Collection().FindOne(ctx, r.filter(filter)).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Find 按 skip/limit 分页查询，Limit 为 0 时不限制
+func (r *Repo[T]) Find(ctx context.Context, filter any, page Page) ([]T, error) {
+	cursor, err := r.Collection().Find(ctx, r.filter(filter), page.options())
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	results := make([]T, 0)
+	err = cursor.All(ctx, &results)
+	return results, err
+}
+
+// Each 按分页参数流式遍历文档，fn 返回 ErrStopIteration 时提前结束
+func (r *Repo[T]) Each(ctx context.Context, filter any, page Page, fn func(T) error) error {
+	cursor, err := r.Collection().Find(ctx, r.filter(filter), page.options())
+	if err != nil {
+		return err
+	}
+	return Each(ctx, cursor, fn)
+}
+
+// AggregateAs 在仓储集合上执行聚合，结果解码为 R；启用软删除时不会自动排除已删除文档
+func AggregateAs[R any, T any](ctx context.Context, r *Repo[T], pipeline any) ([]R, error) {
+	cursor, err := r.Collection().Aggregate(ctx, pipelineStages(pipeline))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	results := make([]R, 0)
+	err = cursor.All(ctx, &results)
+	return results, err
+}
+
+// FindAfter 按 _id 升序的游标分页，after 为上一页返回的 next，首页传 nil；
+// 没有更多数据时 next 为 nil
+func (r *Repo[T]) FindAfter(ctx context.Context, filter any, after any, limit int64) (results []T, next any, err error) {
+	if after != nil {
+		filter = bson.M{"$and": bson.A{r.filter(filter), bson.M{"_id": bson.M{"$gt": after}}}}
+	} else {
+		filter = r.filter(filter)
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := r.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+	results = make([]T, 0)
+	var lastID bson.RawValue
+	for cursor.Next(ctx) {
+		var item T
+		if err = cursor.Decode(&item); err != nil {
+			return nil, nil, err
+		}
+		results = append(results, item)
+		lastID = cursor.Current.Lookup("_id")
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, nil, err
+	}
+	if limit > 0 && int64(len(results)) == limit {
+		var id any
+		if err = lastID.Unmarshal(&id); err != nil {
+			return nil, nil, err
+		}
+		next = id
+	}
+	return results, next, nil
+}
+
+// Count 统计文档数
+func (r *Repo[T]) Count(ctx context.Context, filter any) (int64, error) {
+	return r.Collection().CountDocuments(ctx, r.filter(filter))
+}
+
+// Insert 插入文档，返回 _id
+func (r *Repo[T]) Insert(ctx context.Context, doc *T) (any, error) {
+	d, err := r.stamp(doc)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.Collection().InsertOne(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	return res.InsertedID, nil
+}
+
+// InsertMany 批量插入文档，返回 _id 列表
+func (r *Repo[T]) InsertMany(ctx context.Context, docs []T) ([]any, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	items := make([]any, 0, len(docs))
+	for i := range docs {
+		d, err := r.stamp(&docs[i])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, d)
+	}
+	res, err := r.Collection().InsertMany(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	return res.InsertedIDs, nil
+}
+
+// stamp 转换为 bson.D，设置 created_at/updated_at
+func (r *Repo[T]) stamp(doc *T) (bson.D, error) {
+	if err := checkModelInline(reflect.TypeOf(doc).Elem()); err != nil {
+		return nil, err
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err = bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+	if !r.Timestamps {
+		return d, nil
+	}
+	now := primitive.NewDateTimeFromTime(time.Now())
+	stamped := make(bson.D, 0, len(d)+2)
+	var hasCreated bool
+	for _, e := range d {
+		switch e.Key {
+		case FieldCreatedAt:
+			hasCreated = true
+			if isZeroTime(e.Value) {
+				e.Value = now
+			}
+		case FieldUpdatedAt:
+			continue
+		}
+		stamped = append(stamped, e)
+	}
+	if !hasCreated {
+		stamped = append(stamped, bson.E{Key: FieldCreatedAt, Value: now})
+	}
+	return append(stamped, bson.E{Key: FieldUpdatedAt, Value: now}), nil
+}
+
+// checkModelInline 检查嵌入的 Model 是否声明了 inline，未声明时 _id 和时间字段无法正确写入和读取
+func checkModelInline(t reflect.Type) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	modelType := reflect.TypeOf(Model{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if !f.Anonymous || ft != modelType {
+			continue
+		}
+		tag, ok := f.Tag.Lookup("bson")
+		if !ok || !hasBsonFlag(tag, "inline") {
+			return fmt.Errorf("mongodb: %s embeds mongodb.Model without `bson:\",inline\"`", t)
+		}
+	}
+	return nil
+}
+
+// hasBsonFlag bson 标签是否包含指定选项
+func hasBsonFlag(tag, flag string) bool {
+	parts := strings.Split(tag, ",")
+	for _, p := range parts[1:] {
+		if p == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// isZeroTime 时间字段是否为空
+func isZeroTime(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case primitive.DateTime:
+		return t.Time().IsZero() || t == 0
+	}
+	return false
+}
+
+// Update 按条件更新单个文档
+func (r *Repo[T]) Update(ctx context.Context, filter any, u *Update) (*UpdateResult, error) {
+	return r.Collection().UpdateOne(ctx, r.filter(filter), r.touch(u))
+}
+
+// UpdateByID 按 _id 更新
+func (r *Repo[T]) UpdateByID(ctx context.Context, id any, u *Update) (*UpdateResult, error) {
+	return r.Update(ctx, bson.M{"_id": id}, u)
+}
+
+// UpdateMany 按条件更新多个文档
+func (r *Repo[T]) UpdateMany(ctx context.Context, filter any, u *Update) (*UpdateResult, error) {
+	return r.Collection().UpdateMany(ctx, r.filter(filter), r.touch(u))
+}
+
+// touch 更新时设置 updated_at，返回新的更新文档，不修改调用方的 u；u 为 nil 时视为空更新
+func (r *Repo[T]) touch(u *Update) bson.M {
+	doc := bson.M{}
+	if u != nil {
+		for operator, fields := range u.Document() {
+			doc[operator] = fields
+		}
+	}
+	if r.Timestamps {
+		set := bson.M{}
+		if fields, ok := doc["$set"].(bson.M); ok {
+			for k, v := range fields {
+				set[k] = v
+			}
+		}
+		set[FieldUpdatedAt] = time.Now()
+		doc["$set"] = set
+	}
+	return doc
+}
+
+// Delete 按条件删除，启用软删除时设置 deleted_at
+func (r *Repo[T]) Delete(ctx context.Context, filter any) (int64, error) {
+	if r.SoftDelete {
+		res, err := r.UpdateMany(ctx, filter, NewUpdate().Set(FieldDeletedAt, time.Now()))
+		if err != nil {
+			return 0, err
+		}
+		return res.ModifiedCount, nil
+	}
+	res, err := r.Collection().DeleteMany(ctx, r.filter(filter))
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// DeleteByID 按 _id 删除
+func (r *Repo[T]) DeleteByID(ctx context.Context, id any) (int64, error) {
+	return r.Delete(ctx, bson.M{"_id": id})
+}
+
+// ForceDelete 物理删除，忽略软删除设置
+func (r *Repo[T]) ForceDelete(ctx context.Context, filter any) (int64, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	res, err := r.Collection().DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,38 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type inlineDoc struct {
+	Model `bson:",inline"`
+	Name  string `bson:"name"`
+}
+
+type nestedDoc struct {
+	Model
+	Name string `bson:"name"`
+}
+
+func TestStampRequiresInlineModel(t *testing.T) {
+	if _, err := NewRepo[nestedDoc](nil, "db", "c").stamp(&nestedDoc{Name: "a"}); err == nil {
+		t.Fatal("stamp accepted Model embedded without inline")
+	}
+	d, err := NewRepo[inlineDoc](nil, "db", "c").stamp(&inlineDoc{Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := bson.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got inlineDoc
+	if err = bson.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.CreatedAt.IsZero() || got.UpdatedAt.IsZero() || got.Name != "a" {
+		t.Fatalf("decoded %+v, want timestamps and name", got)
+	}
+}
@@ -0,0 +1,34 @@
+package mongodb
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TransactionOptions = options.TransactionOptions
+type SessionContext = mongo.SessionContext
+
+// WithTransaction 在事务中执行 fn，fn 内的操作需使用传入的 sc 作为 context；
+// 使用驱动的 Session.WithTransaction，遇到 TransientTransactionError 时重新执行整个事务，
+// 提交结果未知（UnknownTransactionCommitResult）时重试提交，总时长不超过 120 秒。
+// fn 可能被执行多次，不应包含事务外的副作用
+//
+//	err := mgo.WithTransaction(ctx, func(sc mongodb.SessionContext) error {
+//		if _, err := mgo.InsertOneContext(sc, "db", "orders", order); err != nil {
+//			return err
+//		}
+//		_, err := mgo.UpdateOneContext(sc, "db", "stock", filter, mongodb.NewUpdate().Inc("count", -1))
+//		return err
+//	})
+func (mgo *Mgo) WithTransaction(ctx context.Context, fn func(sc SessionContext) error, opts ...*TransactionOptions) error {
+	sess, err := mgo.client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(context.Background())
+	_, err = sess.WithTransaction(ctx, func(sc SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	}, opts...)
+	return err
+}
@@ -0,0 +1,103 @@
+package mongodb
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Update 更新文档构造器
+//
+//	u := mongodb.NewUpdate().Set("name", "x").Inc("views", 1).Push("tags", "go")
+type Update struct {
+	doc bson.M
+}
+
+// NewUpdate 创建更新文档构造器
+func NewUpdate() *Update {
+	return &Update{doc: bson.M{}}
+}
+
+// op 设置操作符下的字段
+func (u *Update) op(operator, field string, value any) *Update {
+	fields, ok := u.doc[operator].(bson.M)
+	if !ok {
+		fields = bson.M{}
+		u.doc[operator] = fields
+	}
+	fields[field] = value
+	return u
+}
+
+// Set $set
+func (u *Update) Set(field string, value any) *Update {
+	return u.op("$set", field, value)
+}
+
+// SetOnInsert $setOnInsert，仅 upsert 插入时生效
+func (u *Update) SetOnInsert(field string, value any) *Update {
+	return u.op("$setOnInsert", field, value)
+}
+
+// Unset $unset
+func (u *Update) Unset(field string) *Update {
+	return u.op("$unset", field, "")
+}
+
+// Inc $inc
+func (u *Update) Inc(field string, n any) *Update {
+	return u.op("$inc", field, n)
+}
+
+// Mul $mul
+func (u *Update) Mul(field string, n any) *Update {
+	return u.op("$mul", field, n)
+}
+
+// Min $min
+func (u *Update) Min(field string, value any) *Update {
+	return u.op("$min", field, value)
+}
+
+// Max $max
+func (u *Update) Max(field string, value any) *Update {
+	return u.op("$max", field, value)
+}
+
+// Push $push
+func (u *Update) Push(field string, value any) *Update {
+	return u.op("$push", field, value)
+}
+
+// PushEach $push 配合 $each 追加多个元素
+func (u *Update) PushEach(field string, values ...any) *Update {
+	return u.op("$push", field, bson.M{"$each": values})
+}
+
+// AddToSet $addToSet
+func (u *Update) AddToSet(field string, value any) *Update {
+	return u.op("$addToSet", field, value)
+}
+
+// Pull $pull
+func (u *Update) Pull(field string, value any) *Update {
+	return u.op("$pull", field, value)
+}
+
+// Rename $rename
+func (u *Update) Rename(field, newName string) *Update {
+	return u.op("$rename", field, newName)
+}
+
+// CurrentDate $currentDate
+func (u *Update) CurrentDate(field string) *Update {
+	return u.op("$currentDate", field, true)
+}
+
+// IsEmpty 是否没有任何更新操作
+func (u *Update) IsEmpty() bool {
+	return len(u.doc) == 0
+}
+
+// Document 更新文档
+func (u *Update) Document() bson.M {
+	return u.doc
+}
@@ -0,0 +1,186 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ResumeTokenStore 持久化变更流的 resume token，重启后从上次位置继续
+type ResumeTokenStore interface {
+	// Load 读取 token，不存在时返回 nil, nil
+	Load(ctx context.Context) (bson.Raw, error)
+	Save(ctx context.Context, token bson.Raw) error
+}
+
+// WatchConfig 变更流配置
+type WatchConfig struct {
+	Database   string
+	Collection string
+	// Pipeline 过滤或变换事件的聚合管道，可为 *Pipeline、mongo.Pipeline
+	Pipeline any
+	// FullDocument 更新事件携带更新后的完整文档
+	FullDocument bool
+	// TokenStore 为空时不持久化，每次从当前时间开始监听
+	TokenStore ResumeTokenStore
+}
+
+// ChangeEvent 变更事件
+type ChangeEvent struct {
+	OperationType     string              `bson:"operationType"`
+	DocumentKey       bson.Raw            `bson:"documentKey"`
+	FullDocument      bson.Raw            `bson:"fullDocument"`
+	UpdateDescription bson.Raw            `bson:"updateDescription"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+	// Raw 原始事件
+	Raw bson.Raw `bson:"-"`
+}
+
+// Watch 监听集合变更并回调 fn，直到 ctx 取消或出错；
+// fn 成功返回后保存 resume token，fn 返回错误时停止监听且不保存，重启后该事件会被重新投递；
+// 每批事件结束后保存服务端返回的 postBatchResumeToken，被 Pipeline 过滤掉的事件在重启后不会重放
+func (mgo *Mgo) Watch(ctx context.Context, wc WatchConfig, fn func(ctx context.Context, event ChangeEvent) error) error {
+	opts := options.ChangeStream()
+	if wc.FullDocument {
+		opts.SetFullDocument(options.UpdateLookup)
+	}
+	if wc.TokenStore != nil {
+		token, err := wc.TokenStore.Load(ctx)
+		if err != nil {
+			return err
+		}
+		if len(token) > 0 {
+			opts.SetStartAfter(token)
+		}
+	}
+	stream, err := mgo.client().Database(wc.Database).Collection(wc.Collection).Watch(ctx, pipelineStages(wc.Pipeline), opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+	var saved bson.Raw
+	saveToken := func() error {
+		token := stream.ResumeToken()
+		if wc.TokenStore == nil || len(token) == 0 || bytes.Equal(token, saved) {
+			return nil
+		}
+		if err := wc.TokenStore.Save(ctx, token); err != nil {
+			return err
+		}
+		saved = append(saved[:0], token...)
+		return nil
+	}
+	for {
+		if stream.TryNext(ctx) {
+			var event ChangeEvent
+			if err = stream.Decode(&event); err != nil {
+				return err
+			}
+			event.Raw = stream.Current
+			if err = fn(ctx, event); err != nil {
+				return err
+			}
+			if err = saveToken(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = stream.Err(); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+		// 本批没有更多事件，token 已推进到被过滤事件之后
+		if err = saveToken(); err != nil {
+			return err
+		}
+		if ctx.Err() != nil || stream.ID() == 0 {
+			return nil
+		}
+	}
+}
+
+type fileTokenStore struct {
+	path string
+}
+
+// NewFileTokenStore 将 resume token 保存到本地文件
+func NewFileTokenStore(path string) ResumeTokenStore {
+	return &fileTokenStore{path: path}
+}
+
+func (s *fileTokenStore) Load(ctx context.Context) (bson.Raw, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	token := bson.Raw(data)
+	if err = token.Validate(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Save 先写临时文件再重命名，避免写入中断导致文件损坏
+func (s *fileTokenStore) Save(ctx context.Context, token bson.Raw) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(token); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+type collectionTokenStore struct {
+	mgo        *Mgo
+	database   string
+	collection string
+	id         string
+}
+
+// NewCollectionTokenStore 将 resume token 保存到集合中 _id 为 id 的文档
+func NewCollectionTokenStore(mgo *Mgo, database, collection, id string) ResumeTokenStore {
+	return &collectionTokenStore{mgo: mgo, database: database, collection: collection, id: id}
+}
+
+func (s *collectionTokenStore) Load(ctx context.Context) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := s.mgo.FindOneContext(ctx, s.database, s.collection, bson.M{"_id": s.id}, &doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+func (s *collectionTokenStore) Save(ctx context.Context, token bson.Raw) error {
+	_, err := s.mgo.UpsertContext(ctx, s.database, s.collection, bson.M{"_id": s.id},
+		NewUpdate().Set("token", token).Set(FieldUpdatedAt, time.Now()))
+	return err
+}
@@ -0,0 +1,107 @@
+package rabbitMQ
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 消息内容类型
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeMsgpack  = "application/msgpack"
+)
+
+// Codec 消息编解码器
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var codecLock sync.RWMutex
+var codecs = map[string]Codec{
+	ContentTypeJSON:           jsonCodec{},
+	"text/json":               jsonCodec{},
+	ContentTypeProtobuf:       protoCodec{},
+	"application/protobuf":    protoCodec{},
+	ContentTypeMsgpack:        msgpackCodec{},
+	"application/x-msgpack":   msgpackCodec{},
+	"application/vnd.msgpack": msgpackCodec{},
+}
+
+// RegisterCodec 注册内容类型对应的编解码器
+func RegisterCodec(contentType string, c Codec) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	codecs[strings.ToLower(contentType)] = c
+}
+
+// CodecFor 获取内容类型对应的编解码器，内容类型为空时使用 JSON
+func CodecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+	// 忽略 charset 等参数
+	if i := strings.Index(contentType, ";"); i != -1 {
+		contentType = contentType[:i]
+	}
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	c, ok := codecs[strings.ToLower(strings.TrimSpace(contentType))]
+	if !ok {
+		return nil, fmt.Errorf("rabbitMQ codec for content type %s not found", contentType)
+	}
+	return c, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("rabbitMQ protobuf codec: %T is not proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal 支持 proto.Message 以及指向 proto.Message 指针的指针（Handle[*pb.Msg] 的情况）
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		if m, ok := rv.Elem().Interface().(proto.Message); ok {
+			return proto.Unmarshal(data, m)
+		}
+	}
+	return fmt.Errorf("rabbitMQ protobuf codec: %T is not proto.Message", v)
+}
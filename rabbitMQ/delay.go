@@ -0,0 +1,166 @@
+package rabbitMQ
+
+import (
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"log"
+	"sync"
+	"time"
+)
+
+// 延迟消息插件检测结果
+const (
+	delayPluginUnknown = iota
+	delayPluginEnabled
+	delayPluginDisabled
+)
+
+// delayState 延迟消息拓扑状态
+type delayState struct {
+	mu       sync.Mutex
+	plugin   int
+	declared map[string]bool
+}
+
+// PublishDelayed 延迟 delay 后投递消息到 p.ExChangeName。
+// 已安装 rabbitmq_delayed_message_exchange 插件时使用 <exchange>.delayed 延迟交换器；
+// 否则为每个延迟时长自动创建 TTL 队列，消息过期后通过死信投递到目标交换器并保留原路由键。
+// 未使用插件时每个不同的延迟时长对应一个队列，建议使用固定的几档延迟；
+// 首次发布时使用临时连接检测插件，不影响当前连接上的消费者
+func (r *RabbitMQ) PublishDelayed(playLoad []byte, delay time.Duration, p *PublishConfig) error {
+	contentType := p.ContentType
+	if contentType == "" {
+		contentType = "text/json"
+	}
+	msg := amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		ContentType:  contentType,
+		MessageId:    p.MessageId,
+		Timestamp:    time.Now(),
+		Body:         playLoad,
+		Headers:      amqp.Table{},
+	}
+	if p.SchemaVersion != "" {
+		msg.Headers[schemaVersionHeader] = p.SchemaVersion
+	}
+	if delay <= 0 {
+		return r.publish(p.ExChangeName, p.RoutingKey, p.Mandatory, p.Immediate, msg)
+	}
+	// 默认交换器不能作为绑定目标，只能使用 TTL 队列
+	if p.ExChangeName != "" && r.delayPlugin() {
+		exchange, err := r.declareDelayedExchange(p.ExChangeName)
+		if err != nil {
+			return err
+		}
+		msg.Headers["x-delay"] = delay.Milliseconds()
+		return r.publish(exchange, p.RoutingKey, p.Mandatory, false, msg)
+	}
+	exchange, err := r.declareDelayQueue(p.ExChangeName, delay)
+	if err != nil {
+		return err
+	}
+	return r.publish(exchange, p.RoutingKey, p.Mandatory, false, msg)
+}
+
+// delayPlugin 检测是否安装延迟消息插件。
+// 声明未知类型的交换器是连接级别的错误（503 COMMAND_INVALID），代理会关闭整个连接，
+// 因此使用独立的临时连接检测；只缓存明确的检测结果，连接失败等临时错误下次重新检测
+func (r *RabbitMQ) delayPlugin() bool {
+	r.delay.mu.Lock()
+	defer r.delay.mu.Unlock()
+	if r.delay.plugin == delayPluginUnknown {
+		enabled, err := r.probeDelayPlugin()
+		if err != nil {
+			log.Println("rabbitMQ delayed message plugin probe err:", err)
+			return false
+		}
+		r.delay.plugin = delayPluginDisabled
+		if enabled {
+			r.delay.plugin = delayPluginEnabled
+		}
+	}
+	return r.delay.plugin == delayPluginEnabled
+}
+
+// probeDelayPlugin 在临时连接上声明 x-delayed-message 交换器，声明后立即删除
+func (r *RabbitMQ) probeDelayPlugin() (bool, error) {
+	conn, err := r.dial(r.dialStr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, err
+	}
+	name := "goutil.delayed.probe"
+	err = ch.ExchangeDeclare(name, "x-delayed-message", false, true, false, false, amqp.Table{"x-delayed-type": amqp.ExchangeDirect})
+	if err == nil {
+		ch.ExchangeDelete(name, false, false)
+		return true, nil
+	}
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.CommandInvalid {
+		return false, nil
+	}
+	return false, err
+}
+
+// declareDelayedExchange 声明延迟交换器并绑定到目标交换器，topic 类型配合 # 绑定保留原路由键
+func (r *RabbitMQ) declareDelayedExchange(exchange string) (string, error) {
+	name := exchange + ".delayed"
+	return name, r.declareDelayOnce(name, func(ch Channel) error {
+		err := ch.ExchangeDeclare(name, "x-delayed-message", true, false, false, false, amqp.Table{"x-delayed-type": amqp.ExchangeTopic})
+		if err != nil {
+			return err
+		}
+		return ch.ExchangeBind(exchange, "#", name, false, nil)
+	})
+}
+
+// declareDelayQueue 声明 fanout 交换器和 TTL 队列：<exchange>.delay.<毫秒>，
+// fanout 交换器忽略路由键，消息死信到目标交换器时使用原路由键
+func (r *RabbitMQ) declareDelayQueue(exchange string, delay time.Duration) (string, error) {
+	prefix := exchange
+	if prefix == "" {
+		prefix = "default"
+	}
+	name := fmt.Sprintf("%s.delay.%d", prefix, delay.Milliseconds())
+	return name, r.declareDelayOnce(name, func(ch Channel) error {
+		err := ch.ExchangeDeclare(name, amqp.ExchangeFanout, true, false, false, false, nil)
+		if err != nil {
+			return err
+		}
+		_, err = ch.QueueDeclare(name, true, false, false, false, amqp.Table{
+			"x-message-ttl":          delay.Milliseconds(),
+			"x-dead-letter-exchange": exchange,
+		})
+		if err != nil {
+			return err
+		}
+		return ch.QueueBind(name, "", name, false, nil)
+	})
+}
+
+// declareDelayOnce 每个延迟拓扑只声明一次
+func (r *RabbitMQ) declareDelayOnce(name string, declare func(ch Channel) error) error {
+	r.delay.mu.Lock()
+	defer r.delay.mu.Unlock()
+	if r.delay.declared[name] {
+		return nil
+	}
+	ch, err := r.openChannel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	if err = declare(ch); err != nil {
+		return err
+	}
+	if r.delay.declared == nil {
+		r.delay.declared = make(map[string]bool)
+	}
+	r.delay.declared[name] = true
+	return nil
+}
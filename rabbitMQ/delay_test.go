@@ -0,0 +1,53 @@
+package rabbitMQ_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"github.com/streadway/amqp"
+)
+
+func TestPublishDelayedWithoutPlugin(t *testing.T) {
+	broker, mq := newMQ(t)
+	err := mq.DeclareTopology(&rabbitMQ.Topology{
+		Exchanges: []rabbitMQ.ExchangeConfig{{Name: "orders", Type: amqp.ExchangeDirect, Durable: true}},
+		Queues:    []rabbitMQ.QueueConfig{{Name: "orders.created", Durable: true}},
+		Bindings:  []rabbitMQ.BindingConfig{{Source: "orders", Destination: "orders.created", RoutingKeys: []string{"created"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 10)
+	go mq.Consume(1, func(body []byte) rabbitMQ.ConsumeResult {
+		received <- string(body)
+		return rabbitMQ.ConsumeResult{}
+	}, &rabbitMQ.ConsumeConfig{ConsumeQueue: "orders.created"})
+
+	p := &rabbitMQ.PublishConfig{ExChangeName: "orders", RoutingKey: "created"}
+	start := time.Now()
+	if err = mq.PublishDelayed([]byte("delayed"), 30*time.Millisecond, p); err != nil {
+		t.Fatal(err)
+	}
+	// 检测插件不影响共享连接上的消费者和发布
+	if err = mq.Publish([]byte("now"), p); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"now", "delayed"} {
+		select {
+		case body := <-received:
+			if body != want {
+				t.Fatalf("received %s, want %s", body, want)
+			}
+		case <-time.After(waitTimeout):
+			t.Fatalf("%s message not received", want)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("delayed message received after %s, want at least 30ms", elapsed)
+	}
+	// 未安装插件时使用 TTL 队列，检测用的交换器已删除
+	if !broker.HasQueue("orders.delay.30") || broker.HasExchange("goutil.delayed.probe") {
+		t.Fatal("want ttl delay queue without probe exchange")
+	}
+}
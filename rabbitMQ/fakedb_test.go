@@ -0,0 +1,405 @@
+package rabbitMQ_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeDB 只支持发件箱投递器生成的 SQL 的内存数据库：单表的 INSERT、带 WHERE 的 SELECT * 和 UPDATE，
+// WHERE 支持 AND、OR、括号以及 =、<、>=、IN 比较，事务回滚时恢复开始时的快照
+type fakeDB struct {
+	mu     sync.Mutex
+	nextId int64
+	rows   map[int64]map[string]driver.Value
+	// 事务开始时的快照
+	snapshot map[int64]map[string]driver.Value
+}
+
+var (
+	fakeDriverSeq int
+
+	insertPattern = regexp.MustCompile("^INSERT INTO `\\w+` \\((.+?)\\) VALUES \\((.+)\\)$")
+	selectPattern = regexp.MustCompile("^SELECT \\* FROM `\\w+` WHERE (.+?) ORDER BY (\\w+) LIMIT (\\d+)( FOR UPDATE SKIP LOCKED)?$")
+	updatePattern = regexp.MustCompile("^UPDATE `\\w+` SET (.+?) WHERE (.+)$")
+	termPattern   = regexp.MustCompile("^`?(\\w+)`? (=|<|>=) \\?$")
+	inPattern     = regexp.MustCompile("^`?(\\w+)`? IN \\(([?,]+)\\)$")
+	setPattern    = regexp.MustCompile("^`(\\w+)`=(\\?|(\\w+) \\+ (\\d+))$")
+)
+
+// newFakeDB 创建使用 fakeDB 的 gorm 连接
+func newFakeDB(t *testing.T) (*gorm.DB, *fakeDB) {
+	t.Helper()
+	f := &fakeDB{rows: make(map[int64]map[string]driver.Value)}
+	fakeDriverSeq++
+	name := fmt.Sprintf("fakedb-%d", fakeDriverSeq)
+	sql.Register(name, fakeDriver{f})
+	sqlDB, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger:               logger.Default.LogMode(logger.Silent),
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, f
+}
+
+// row 读取一行的副本
+func (f *fakeDB) row(id int64) map[string]driver.Value {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	row := make(map[string]driver.Value)
+	for k, v := range f.rows[id] {
+		row[k] = v
+	}
+	return row
+}
+
+// set 修改一行的列
+func (f *fakeDB) set(id int64, column string, value driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rows[id][column] = value
+}
+
+type fakeDriver struct {
+	db *fakeDB
+}
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{db: d.db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakedb: prepare not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.snapshot = copyRows(f.rows)
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.snapshot = nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.snapshot != nil {
+		f.rows = f.snapshot
+		f.snapshot = nil
+	}
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	args := values(named)
+	if m := insertPattern.FindStringSubmatch(query); m != nil {
+		columns := strings.Split(m[1], ",")
+		if len(columns) != len(args) {
+			return nil, fmt.Errorf("fakedb: %d columns with %d args", len(columns), len(args))
+		}
+		f.nextId++
+		row := map[string]driver.Value{"id": f.nextId}
+		for i, column := range columns {
+			row[strings.Trim(column, "`")] = args[i]
+		}
+		f.rows[f.nextId] = row
+		return fakeResult{lastId: f.nextId, affected: 1}, nil
+	}
+	if m := updatePattern.FindStringSubmatch(query); m != nil {
+		type assignment struct {
+			column string
+			value  func(row map[string]driver.Value) driver.Value
+		}
+		var assignments []assignment
+		for _, item := range strings.Split(m[1], ",") {
+			s := setPattern.FindStringSubmatch(item)
+			if s == nil {
+				return nil, fmt.Errorf("fakedb: unsupported assignment %s", item)
+			}
+			if s[2] == "?" {
+				v := args[0]
+				args = args[1:]
+				assignments = append(assignments, assignment{s[1], func(map[string]driver.Value) driver.Value { return v }})
+				continue
+			}
+			column := s[3]
+			n, _ := strconv.ParseInt(s[4], 10, 64)
+			assignments = append(assignments, assignment{s[1], func(row map[string]driver.Value) driver.Value { return toInt(row[column]) + n }})
+		}
+		var affected int64
+		for _, id := range f.ids() {
+			row := f.rows[id]
+			ok, _, err := match(m[2], args, row)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			for _, a := range assignments {
+				row[a.column] = a.value(row)
+			}
+			affected++
+		}
+		return fakeResult{affected: affected}, nil
+	}
+	return nil, fmt.Errorf("fakedb: unsupported exec %s", query)
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m := selectPattern.FindStringSubmatch(query)
+	if m == nil || m[2] != "id" {
+		return nil, fmt.Errorf("fakedb: unsupported query %s", query)
+	}
+	limit, _ := strconv.Atoi(m[3])
+	args := values(named)
+	rows := &fakeRows{}
+	for _, id := range f.ids() {
+		ok, _, err := match(m[1], args, f.rows[id])
+		if err != nil {
+			return nil, err
+		}
+		if ok && len(rows.rows) < limit {
+			rows.rows = append(rows.rows, f.rows[id])
+		}
+	}
+	for column := range f.columns() {
+		rows.columns = append(rows.columns, column)
+	}
+	sort.Strings(rows.columns)
+	return rows, nil
+}
+
+// ids 按主键排序的全部行
+func (f *fakeDB) ids() []int64 {
+	ids := make([]int64, 0, len(f.rows))
+	for id := range f.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// columns 出现过的全部列
+func (f *fakeDB) columns() map[string]bool {
+	columns := map[string]bool{"id": true}
+	for _, row := range f.rows {
+		for column := range row {
+			columns[column] = true
+		}
+	}
+	return columns
+}
+
+// match 计算 WHERE 条件，返回是否匹配及使用的参数个数
+func match(where string, args []driver.Value, row map[string]driver.Value) (bool, int, error) {
+	where = strings.TrimSpace(where)
+	// 先按最外层的 OR 拆分，再按 AND 拆分
+	for _, op := range []string{" OR ", " AND "} {
+		parts := splitTopLevel(where, op)
+		if len(parts) == 1 {
+			continue
+		}
+		var used int
+		result := op == " AND "
+		for _, part := range parts {
+			ok, n, err := match(part, args[used:], row)
+			if err != nil {
+				return false, 0, err
+			}
+			used += n
+			if op == " OR " {
+				result = result || ok
+			} else {
+				result = result && ok
+			}
+		}
+		return result, used, nil
+	}
+	if strings.HasPrefix(where, "(") && strings.HasSuffix(where, ")") {
+		return match(where[1:len(where)-1], args, row)
+	}
+	if m := inPattern.FindStringSubmatch(where); m != nil {
+		n := strings.Count(m[2], "?")
+		for _, v := range args[:n] {
+			if compare(row[m[1]], v) == 0 {
+				return true, n, nil
+			}
+		}
+		return false, n, nil
+	}
+	m := termPattern.FindStringSubmatch(where)
+	if m == nil {
+		return false, 0, fmt.Errorf("fakedb: unsupported condition %s", where)
+	}
+	v := row[m[1]]
+	if v == nil {
+		// 与 SQL 一致，NULL 参与比较的结果为假
+		return false, 1, nil
+	}
+	c := compare(v, args[0])
+	switch m[2] {
+	case "=":
+		return c == 0, 1, nil
+	case "<":
+		return c < 0, 1, nil
+	default:
+		return c >= 0, 1, nil
+	}
+}
+
+// splitTopLevel 按括号外的 sep 拆分
+func splitTopLevel(s, sep string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 && strings.HasPrefix(s[i:], sep) {
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// compare 比较整数或时间
+func compare(a, b driver.Value) int {
+	if ta, ok := a.(time.Time); ok {
+		tb, _ := b.(time.Time)
+		switch {
+		case ta.Before(tb):
+			return -1
+		case ta.After(tb):
+			return 1
+		}
+		return 0
+	}
+	ia, ib := toInt(a), toInt(b)
+	switch {
+	case ia < ib:
+		return -1
+	case ia > ib:
+		return 1
+	}
+	return 0
+}
+
+// toInt 整数列的值
+func toInt(v driver.Value) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case uint64:
+		return int64(n)
+	}
+	return 0
+}
+
+// values 提取参数值
+func values(named []driver.NamedValue) []driver.Value {
+	args := make([]driver.Value, len(named))
+	for i, v := range named {
+		args[i] = v.Value
+	}
+	return args
+}
+
+// copyRows 复制全部行
+func copyRows(rows map[int64]map[string]driver.Value) map[int64]map[string]driver.Value {
+	c := make(map[int64]map[string]driver.Value, len(rows))
+	for id, row := range rows {
+		r := make(map[string]driver.Value, len(row))
+		for k, v := range row {
+			r[k] = v
+		}
+		c[id] = r
+	}
+	return c
+}
+
+type fakeResult struct {
+	lastId   int64
+	affected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.lastId, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    []map[string]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	for i, column := range r.columns {
+		dest[i] = row[column]
+	}
+	return nil
+}
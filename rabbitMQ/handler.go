@@ -0,0 +1,108 @@
+package rabbitMQ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"log"
+	"time"
+)
+
+// 消息结构版本消息头
+const schemaVersionHeader = "x-schema-version"
+
+// Meta 消息元数据
+type Meta struct {
+	Exchange      string
+	RoutingKey    string
+	MessageId     string
+	CorrelationId string
+	ContentType   string
+	Type          string
+	AppId         string
+	SchemaVersion string
+	Timestamp     time.Time
+	Redelivered   bool
+	Headers       amqp.Table
+}
+
+// newMeta 从消息中提取元数据
+func newMeta(d *amqp.Delivery) Meta {
+	m := Meta{
+		Exchange:      d.Exchange,
+		RoutingKey:    d.RoutingKey,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		ContentType:   d.ContentType,
+		Type:          d.Type,
+		AppId:         d.AppId,
+		Timestamp:     d.Timestamp,
+		Redelivered:   d.Redelivered,
+		Headers:       d.Headers,
+	}
+	m.SchemaVersion, _ = d.Headers[schemaVersionHeader].(string)
+	return m
+}
+
+// Handle 按内容类型解码消息后调用 fn。
+// 解码失败的消息直接 nack 不重新入队，队列配置了死信交换器时进入死信队列；
+// fn 返回错误时，配置了 c.Retry 则按重试策略处理，否则 nack 不重新入队，
+// fn 也可以直接返回 Fail/Retry 构造的 ConsumeResult 指定处理方式
+func Handle[T any](r *RabbitMQ, consumerCount int, c *ConsumeConfig, fn func(ctx context.Context, msg T, meta Meta) error) error {
+	return r.ConsumeDelivery(consumerCount, func(ctx context.Context, d *amqp.Delivery) ConsumeResult {
+		meta := newMeta(d)
+		var msg T
+		codec, err := CodecFor(d.ContentType)
+		if err == nil {
+			err = codec.Unmarshal(d.Body, &msg)
+		}
+		if err != nil {
+			log.Printf("decode message[%s] err:%s\n", meta.MessageId, err)
+			return ConsumeResult{error: fmt.Errorf("decode message: %w", err)}
+		}
+		if err = fn(ctx, msg, meta); err == nil {
+			return ConsumeResult{}
+		}
+		var result ConsumeResult
+		if errors.As(err, &result) {
+			return result
+		}
+		if c.Retry != nil {
+			return Retry(err)
+		}
+		return ConsumeResult{error: err}
+	}, c)
+}
+
+// Publish 按 p.ContentType 编码消息后发布，默认 JSON
+func Publish[T any](r *RabbitMQ, msg T, p *PublishConfig) error {
+	contentType := p.ContentType
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+	codec, err := CodecFor(contentType)
+	if err != nil {
+		return err
+	}
+	body, err := codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	publishing := amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		ContentType:  contentType,
+		MessageId:    p.MessageId,
+		Timestamp:    time.Now(),
+		Body:         body,
+	}
+	if publishing.MessageId == "" {
+		if publishing.MessageId, err = newId(); err != nil {
+			return err
+		}
+	}
+	if p.SchemaVersion != "" {
+		publishing.Headers = amqp.Table{schemaVersionHeader: p.SchemaVersion}
+	}
+	return r.publish(p.ExChangeName, p.RoutingKey, p.Mandatory, p.Immediate, publishing)
+}
@@ -0,0 +1,83 @@
+package rabbitMQ_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+)
+
+type order struct {
+	Id     int    `json:"id" msgpack:"id"`
+	Status string `json:"status" msgpack:"status"`
+}
+
+func TestHandleDecodesAndDeadLettersInvalid(t *testing.T) {
+	broker, mq := newMQ(t)
+	declareQueue(t, mq, "orders", map[string]interface{}{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "orders.dead"})
+	declareQueue(t, mq, "orders.dead", nil)
+	received := make(chan rabbitMQ.Meta, 10)
+	orders := make(chan order, 10)
+	go rabbitMQ.Handle(mq, 1, &rabbitMQ.ConsumeConfig{ConsumeQueue: "orders"}, func(ctx context.Context, o order, meta rabbitMQ.Meta) error {
+		orders <- o
+		received <- meta
+		return nil
+	})
+
+	p := &rabbitMQ.PublishConfig{RoutingKey: "orders", SchemaVersion: "v2"}
+	if err := rabbitMQ.Publish(mq, order{Id: 1, Status: "paid"}, p); err != nil {
+		t.Fatal(err)
+	}
+	p.ContentType = rabbitMQ.ContentTypeMsgpack
+	if err := rabbitMQ.Publish(mq, order{Id: 2, Status: "paid"}, p); err != nil {
+		t.Fatal(err)
+	}
+	// 消息体无法解码、内容类型不支持
+	if err := mq.Publish([]byte("not json"), &rabbitMQ.PublishConfig{RoutingKey: "orders", ContentType: rabbitMQ.ContentTypeJSON}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mq.Publish([]byte("{}"), &rabbitMQ.PublishConfig{RoutingKey: "orders", ContentType: "text/xml"}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "dead letters", func() bool { return broker.QueueLen("orders.dead") == 2 })
+	if n := len(orders); n != 2 {
+		t.Fatalf("handled %d messages, want 2", n)
+	}
+	for id := 1; id <= 2; id++ {
+		o, meta := <-orders, <-received
+		if o.Id != id || o.Status != "paid" {
+			t.Fatalf("decoded order = %+v, want id %d paid", o, id)
+		}
+		if meta.SchemaVersion != "v2" || meta.MessageId == "" {
+			t.Fatalf("meta = %+v, want schema version v2 and message id", meta)
+		}
+	}
+	if got := broker.QueueLen("orders"); got != 0 {
+		t.Fatalf("orders len = %d, want 0", got)
+	}
+}
+
+func TestHandleErrorResult(t *testing.T) {
+	broker, mq := newMQ(t)
+	declareQueue(t, mq, "orders", map[string]interface{}{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "orders.dead"})
+	declareQueue(t, mq, "orders.dead", nil)
+	calls := make(chan order, 10)
+	go rabbitMQ.Handle(mq, 1, &rabbitMQ.ConsumeConfig{ConsumeQueue: "orders"}, func(ctx context.Context, o order, meta rabbitMQ.Meta) error {
+		calls <- o
+		// 首次投递要求重新入队，重新投递后返回普通错误
+		if !meta.Redelivered {
+			return rabbitMQ.Fail(errors.New("not ready"), true)
+		}
+		return context.Canceled
+	})
+	if err := rabbitMQ.Publish(mq, order{Id: 1}, &rabbitMQ.PublishConfig{RoutingKey: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	// 未配置重试时普通错误 nack 不重新入队
+	waitFor(t, "dead letter", func() bool { return broker.QueueLen("orders.dead") == 1 })
+	if n := len(calls); n != 2 {
+		t.Fatalf("handler called %d times, want 2", n)
+	}
+}
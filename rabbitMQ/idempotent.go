@@ -0,0 +1,297 @@
+package rabbitMQ
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aidenliu/goutil/memcached"
+	"github.com/streadway/amqp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"sync"
+	"time"
+)
+
+// ClaimState 幂等记录状态
+type ClaimState int
+
+const (
+	// Claimed 占用成功，由当前消费者处理
+	Claimed ClaimState = iota
+	// Processing 其他消费者正在处理
+	Processing
+	// Processed 已处理过
+	Processed
+)
+
+const (
+	// 默认处理租期，消费者异常退出后租期到期可重新处理
+	idempotentDefaultLease = 5 * time.Minute
+	// 默认去重窗口
+	idempotentDefaultTTL = 24 * time.Hour
+	// 内存存储清理过期记录的间隔
+	memorySweepInterval = time.Minute
+	// memcached key 最大长度
+	memcachedMaxKeyLen = 250
+)
+
+// ErrInFlight 相同消息正在被其他消费者处理
+var ErrInFlight = errors.New("rabbitMQ message is processing by another consumer")
+
+// IdempotencyStore 幂等记录存储，Claim 必须是原子操作
+type IdempotencyStore interface {
+	// Claim 占用 key，lease 为处理租期
+	Claim(ctx context.Context, key string, lease time.Duration) (ClaimState, error)
+	// Commit 标记 key 已处理，ttl 内的重复消息直接确认
+	Commit(ctx context.Context, key string, ttl time.Duration) error
+	// Release 处理失败后释放 key，允许重新处理
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotentConfig 幂等中间件配置
+type IdempotentConfig struct {
+	Store IdempotencyStore
+	// Prefix key 前缀，用于区分不同的消费者
+	Prefix string
+	// Lease 处理租期，默认 5 分钟
+	Lease time.Duration
+	// TTL 去重窗口，默认 24 小时
+	TTL time.Duration
+	// KeyFunc 幂等 key，默认使用 MessageId，MessageId 为空时使用消息体 sha256
+	KeyFunc func(d *amqp.Delivery) string
+}
+
+// MessageKey 默认幂等 key
+func MessageKey(d *amqp.Delivery) string {
+	if d.MessageId != "" {
+		return d.MessageId
+	}
+	sum := sha256.Sum256(d.Body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Idempotent 幂等消费中间件：处理前占用 key，成功后提交，失败后释放。
+// 已处理的重复消息直接确认，正在被其他消费者处理或存储不可用时按 ConsumeConfig.Retry 延迟重试，
+// 需要配合 ConsumeConfig.Retry 使用，未配置时这些消息 nack 不重新入队
+func Idempotent(ic IdempotentConfig) Middleware {
+	if ic.Lease <= 0 {
+		ic.Lease = idempotentDefaultLease
+	}
+	if ic.TTL <= 0 {
+		ic.TTL = idempotentDefaultTTL
+	}
+	if ic.KeyFunc == nil {
+		ic.KeyFunc = MessageKey
+	}
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, d *amqp.Delivery) ConsumeResult {
+			key := ic.Prefix + ic.KeyFunc(d)
+			state, err := ic.Store.Claim(ctx, key, ic.Lease)
+			if err != nil {
+				// 存储不可用时立即重新入队会空转，按重试策略延迟处理
+				return Retry(fmt.Errorf("idempotent claim %s: %w", key, err))
+			}
+			switch state {
+			case Processed:
+				log.Printf("duplicate message[%s] skipped\n", key)
+				return ConsumeResult{}
+			case Processing:
+				return Retry(ErrInFlight)
+			}
+			result := next(ctx, d)
+			if result.error == nil {
+				if err = ic.Store.Commit(ctx, key, ic.TTL); err != nil {
+					log.Printf("idempotent commit %s err:%s\n", key, err)
+				}
+			} else if err = ic.Store.Release(ctx, key); err != nil {
+				log.Printf("idempotent release %s err:%s\n", key, err)
+			}
+			return result
+		}
+	}
+}
+
+// memoryIdempotencyStore 内存幂等存储，仅对单个进程有效
+type memoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]memoryIdempotencyRecord
+	nextSweep time.Time
+}
+
+type memoryIdempotencyRecord struct {
+	state    ClaimState
+	expireAt time.Time
+}
+
+// NewMemoryIdempotencyStore 创建内存幂等存储
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]memoryIdempotencyRecord)}
+}
+
+func (s *memoryIdempotencyStore) Claim(ctx context.Context, key string, lease time.Duration) (ClaimState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if rec, ok := s.records[key]; ok && rec.expireAt.After(now) {
+		return rec.state, nil
+	}
+	// 定期顺带清理过期记录，避免每次占用都遍历全部记录
+	if now.After(s.nextSweep) {
+		for k, rec := range s.records {
+			if !rec.expireAt.After(now) {
+				delete(s.records, k)
+			}
+		}
+		s.nextSweep = now.Add(memorySweepInterval)
+	}
+	s.records[key] = memoryIdempotencyRecord{state: Processing, expireAt: now.Add(lease)}
+	return Claimed, nil
+}
+
+func (s *memoryIdempotencyStore) Commit(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = memoryIdempotencyRecord{state: Processed, expireAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// memcachedIdempotencyStore memcached 幂等存储，使用 add 保证占用的原子性，
+// 超过 250 字节或包含空白、控制字符的 key 使用 sha256 摘要
+type memcachedIdempotencyStore struct {
+	c *memcached.Client
+}
+
+var (
+	memcachedProcessing = []byte("processing")
+	memcachedProcessed  = []byte("processed")
+)
+
+// NewMemcachedIdempotencyStore 创建 memcached 幂等存储
+func NewMemcachedIdempotencyStore(c *memcached.Client) IdempotencyStore {
+	return &memcachedIdempotencyStore{c: c}
+}
+
+// memcachedKey 转换为合法的 memcached key
+func memcachedKey(key string) string {
+	valid := len(key) > 0 && len(key) <= memcachedMaxKeyLen
+	for i := 0; valid && i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			valid = false
+		}
+	}
+	if valid {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (s *memcachedIdempotencyStore) Claim(ctx context.Context, key string, lease time.Duration) (ClaimState, error) {
+	key = memcachedKey(key)
+	err := s.c.Add(key, memcachedProcessing, expireSeconds(lease))
+	if err == nil {
+		return Claimed, nil
+	}
+	if !errors.Is(err, memcached.ErrNotStored) {
+		return Processing, err
+	}
+	if string(s.c.Get(key)) == string(memcachedProcessed) {
+		return Processed, nil
+	}
+	return Processing, nil
+}
+
+func (s *memcachedIdempotencyStore) Commit(ctx context.Context, key string, ttl time.Duration) error {
+	return s.c.Set(memcachedKey(key), memcachedProcessed, expireSeconds(ttl))
+}
+
+func (s *memcachedIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.c.Del(memcachedKey(key))
+}
+
+// expireSeconds memcached 过期时间，不足 1 秒按 1 秒
+func expireSeconds(d time.Duration) int32 {
+	seconds := int32((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// IdempotencyRecord MySQL 幂等记录
+type IdempotencyRecord struct {
+	IdKey    string    `gorm:"primaryKey;size:191"`
+	State    int8      `gorm:"not null;default:0"`
+	ExpireAt time.Time `gorm:"not null;index"`
+}
+
+// mysqlIdempotencyStore MySQL 幂等存储，使用 INSERT ... ON DUPLICATE KEY UPDATE 保证占用的原子性，
+// 依赖默认的影响行数语义，DSN 不可开启 clientFoundRows
+type mysqlIdempotencyStore struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewMysqlIdempotencyStore 创建 MySQL 幂等存储，table 为空时使用 mq_idempotency
+func NewMysqlIdempotencyStore(db *gorm.DB, table string) IdempotencyStore {
+	if table == "" {
+		table = "mq_idempotency"
+	}
+	return &mysqlIdempotencyStore{db: db, table: table}
+}
+
+// MigrateIdempotency 创建 MySQL 幂等记录表
+func MigrateIdempotency(db *gorm.DB, table string) error {
+	if table == "" {
+		table = "mq_idempotency"
+	}
+	return db.Table(table).AutoMigrate(&IdempotencyRecord{})
+}
+
+func (s *mysqlIdempotencyStore) Claim(ctx context.Context, key string, lease time.Duration) (ClaimState, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+	rec := IdempotencyRecord{IdKey: key, State: int8(Processing), ExpireAt: now.Add(lease)}
+	// 记录不存在时插入，已过期时重新占用；state 必须在 expire_at 之前赋值，使用的是旧的 expire_at
+	res := db.Table(s.table).Clauses(clause.OnConflict{DoUpdates: clause.Set{
+		{Column: clause.Column{Name: "state"}, Value: gorm.Expr("IF(expire_at < ?, VALUES(state), state)", now)},
+		{Column: clause.Column{Name: "expire_at"}, Value: gorm.Expr("IF(expire_at < ?, VALUES(expire_at), expire_at)", now)},
+	}}).Create(&rec)
+	if res.Error != nil {
+		return Processing, res.Error
+	}
+	// 插入影响 1 行，更新影响 2 行，未过期时不修改影响 0 行
+	if res.RowsAffected > 0 {
+		return Claimed, nil
+	}
+	var current IdempotencyRecord
+	err := db.Table(s.table).Where("id_key = ?", key).Take(&current).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 刚被释放，由下一次投递重新占用
+		return Processing, nil
+	}
+	if err != nil {
+		return Processing, err
+	}
+	return ClaimState(current.State), nil
+}
+
+func (s *mysqlIdempotencyStore) Commit(ctx context.Context, key string, ttl time.Duration) error {
+	return s.db.WithContext(ctx).Table(s.table).
+		Where("id_key = ?", key).
+		Updates(map[string]interface{}{"state": int8(Processed), "expire_at": time.Now().Add(ttl)}).Error
+}
+
+func (s *mysqlIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Table(s.table).Where("id_key = ?", key).Delete(&IdempotencyRecord{}).Error
+}
@@ -0,0 +1,93 @@
+package rabbitMQ_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"github.com/streadway/amqp"
+)
+
+func TestIdempotentSkipsDuplicates(t *testing.T) {
+	broker, mq := newMQ(t)
+	declareQueue(t, mq, "orders", nil)
+	var calls int32
+	handled := make(chan string, 10)
+	go mq.ConsumeDelivery(1, func(ctx context.Context, d *amqp.Delivery) rabbitMQ.ConsumeResult {
+		// 首次处理失败并重新入队，释放占用后可以重新处理
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return rabbitMQ.Fail(errors.New("not ready"), true)
+		}
+		handled <- d.MessageId
+		return rabbitMQ.ConsumeResult{}
+	}, &rabbitMQ.ConsumeConfig{
+		ConsumeQueue: "orders",
+		Middlewares:  []rabbitMQ.Middleware{rabbitMQ.Idempotent(rabbitMQ.IdempotentConfig{Store: rabbitMQ.NewMemoryIdempotencyStore()})},
+	})
+	for _, id := range []string{"m1", "m1", "m2"} {
+		if err := mq.Publish([]byte("{}"), &rabbitMQ.PublishConfig{RoutingKey: "orders", MessageId: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "handled", func() bool { return len(handled) == 2 })
+	waitFor(t, "acked", func() bool { return broker.QueueLen("orders") == 0 })
+	// 等待可能的重复处理
+	time.Sleep(20 * time.Millisecond)
+	if n := len(handled); n != 2 {
+		t.Fatalf("handled %d messages, want 2", n)
+	}
+	if a, b := <-handled, <-handled; a != "m1" || b != "m2" {
+		t.Fatalf("handled %s %s, want m1 m2", a, b)
+	}
+}
+
+// failingStore 不可用的幂等存储
+type failingStore struct {
+	claims int32
+}
+
+func (s *failingStore) Claim(ctx context.Context, key string, lease time.Duration) (rabbitMQ.ClaimState, error) {
+	atomic.AddInt32(&s.claims, 1)
+	return rabbitMQ.Processing, errors.New("store unavailable")
+}
+
+func (s *failingStore) Commit(ctx context.Context, key string, ttl time.Duration) error {
+	return nil
+}
+
+func (s *failingStore) Release(ctx context.Context, key string) error {
+	return nil
+}
+
+func TestIdempotentStoreErrorRetries(t *testing.T) {
+	broker, mq := newMQ(t)
+	rc := &rabbitMQ.RetryConfig{Queue: "orders", Backoff: []time.Duration{10 * time.Millisecond}, MaxAttempts: 2}
+	declareQueue(t, mq, "orders", nil)
+	if err := mq.DeclareRetry(rc); err != nil {
+		t.Fatal(err)
+	}
+	store := &failingStore{}
+	var calls int32
+	go mq.ConsumeDelivery(1, func(ctx context.Context, d *amqp.Delivery) rabbitMQ.ConsumeResult {
+		atomic.AddInt32(&calls, 1)
+		return rabbitMQ.ConsumeResult{}
+	}, &rabbitMQ.ConsumeConfig{
+		ConsumeQueue: "orders",
+		Retry:        rc,
+		Middlewares:  []rabbitMQ.Middleware{rabbitMQ.Idempotent(rabbitMQ.IdempotentConfig{Store: store})},
+	})
+	if err := mq.Publish([]byte("{}"), &rabbitMQ.PublishConfig{RoutingKey: "orders", MessageId: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+	// 存储不可用时按退避重试，重试次数用完后进入 parking lot，而不是立即重新入队空转
+	waitFor(t, "parking lot", func() bool { return broker.QueueLen("orders.parking") == 1 })
+	if n := atomic.LoadInt32(&store.claims); n != 3 {
+		t.Fatalf("claims = %d, want 3", n)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("handler called %d times, want 0", n)
+	}
+}
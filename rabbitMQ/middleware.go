@@ -0,0 +1,197 @@
+package rabbitMQ
+
+import (
+	"context"
+	"fmt"
+	"github.com/streadway/amqp"
+	"hash/fnv"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// DeliveryHandler 消息处理函数
+type DeliveryHandler func(ctx context.Context, d *amqp.Delivery) ConsumeResult
+
+// Middleware 消费中间件，包装 DeliveryHandler
+type Middleware func(next DeliveryHandler) DeliveryHandler
+
+// Chain 组合中间件，第一个中间件在最外层
+func Chain(h DeliveryHandler, mws ...Middleware) DeliveryHandler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Logging 记录每条消息的处理耗时和结果
+func Logging() Middleware {
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, d *amqp.Delivery) ConsumeResult {
+			start := time.Now()
+			result := next(ctx, d)
+			log.Printf("consume message[%s] routingKey[%s] cost[%s] err[%v]\n", d.MessageId, d.RoutingKey, time.Since(start), result.error)
+			return result
+		}
+	}
+}
+
+// Recover 捕获处理函数的 panic，消息 nack 不重新入队，避免消费协程退出
+func Recover() Middleware {
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, d *amqp.Delivery) (result ConsumeResult) {
+			defer func() {
+				if e := recover(); e != nil {
+					log.Printf("consume message[%s] panic:%v\n%s", d.MessageId, e, debug.Stack())
+					result = Fail(fmt.Errorf("panic: %v", e), false)
+				}
+			}()
+			return next(ctx, d)
+		}
+	}
+}
+
+// Timeout 限制单条消息的处理时间，超时后按 ConsumeConfig.Retry 重试，
+// 未配置重试时 nack 不重新入队，队列配置了死信交换器时进入死信队列。
+// 处理函数需要响应 ctx 的取消，否则超时后仍会在后台继续执行
+func Timeout(timeout time.Duration) Middleware {
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, d *amqp.Delivery) ConsumeResult {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			done := make(chan ConsumeResult, 1)
+			go func() {
+				done <- next(ctx, d)
+			}()
+			select {
+			case result := <-done:
+				return result
+			case <-ctx.Done():
+				return ConsumeResult{error: fmt.Errorf("consume message timeout: %w", ctx.Err()), Retry: true}
+			}
+		}
+	}
+}
+
+// RateLimit 限制每秒处理的消息数，burst 为允许的突发数量，perSecond 不大于 0 时不限制
+func RateLimit(perSecond float64, burst int) Middleware {
+	if perSecond <= 0 {
+		return func(next DeliveryHandler) DeliveryHandler {
+			return next
+		}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	bucket := &tokenBucket{rate: perSecond, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, d *amqp.Delivery) ConsumeResult {
+			if err := bucket.wait(ctx); err != nil {
+				return Fail(err, true)
+			}
+			return next(ctx, d)
+		}
+	}
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// wait 等待获取一个令牌
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// MetricsRecorder 消费指标收集
+type MetricsRecorder interface {
+	// Observe 记录一条消息的处理耗时和结果
+	Observe(d *amqp.Delivery, elapsed time.Duration, result ConsumeResult)
+}
+
+// Metrics 收集消费指标
+func Metrics(recorder MetricsRecorder) Middleware {
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, d *amqp.Delivery) ConsumeResult {
+			start := time.Now()
+			result := next(ctx, d)
+			recorder.Observe(d, time.Since(start), result)
+			return result
+		}
+	}
+}
+
+// workerPool 消息处理协程池，设置 partitionKey 时相同 key 的消息由同一个协程顺序处理
+type workerPool struct {
+	queues       []chan amqp.Delivery
+	partitionKey func(d *amqp.Delivery) string
+	wg           sync.WaitGroup
+}
+
+func newWorkerPool(workers int, partitionKey func(d *amqp.Delivery) string, handle func(d *amqp.Delivery)) *workerPool {
+	p := &workerPool{partitionKey: partitionKey}
+	// 未设置 partitionKey 时所有协程共享一个队列
+	queueCount := 1
+	if partitionKey != nil {
+		queueCount = workers
+	}
+	for i := 0; i < queueCount; i++ {
+		p.queues = append(p.queues, make(chan amqp.Delivery))
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func(queue chan amqp.Delivery) {
+			defer p.wg.Done()
+			for d := range queue {
+				d := d
+				handle(&d)
+			}
+		}(p.queues[i%queueCount])
+	}
+	return p
+}
+
+// dispatch 分发消息到协程
+func (p *workerPool) dispatch(d amqp.Delivery) {
+	if p.partitionKey == nil {
+		p.queues[0] <- d
+		return
+	}
+	h := fnv.New32a()
+	h.Write([]byte(p.partitionKey(&d)))
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- d
+}
+
+// close 关闭队列并等待处理中的消息完成
+func (p *workerPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
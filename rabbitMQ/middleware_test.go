@@ -0,0 +1,136 @@
+package rabbitMQ_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"github.com/streadway/amqp"
+)
+
+func TestTimeoutKeepsDeliveryOwnedByHandler(t *testing.T) {
+	broker, mq := newMQ(t)
+	declareQueue(t, mq, "jobs", map[string]interface{}{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "jobs.dead"})
+	declareQueue(t, mq, "jobs.dead", nil)
+	late := make(chan string, 1)
+	go mq.ConsumeDelivery(1, func(ctx context.Context, d *amqp.Delivery) rabbitMQ.ConsumeResult {
+		if string(d.Body) == "m1" {
+			// 超时后继续读取消息，期间下一条消息已被投递
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			late <- string(d.Body)
+		}
+		return rabbitMQ.ConsumeResult{}
+	}, &rabbitMQ.ConsumeConfig{
+		ConsumeQueue: "jobs",
+		Middlewares:  []rabbitMQ.Middleware{rabbitMQ.Timeout(10 * time.Millisecond)},
+	})
+	for _, body := range []string{"m1", "m2"} {
+		if err := mq.Publish([]byte(body), &rabbitMQ.PublishConfig{RoutingKey: "jobs"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case body := <-late:
+		if body != "m1" {
+			t.Fatalf("late read body = %s, want m1", body)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("handler did not finish")
+	}
+	// 超时且未配置重试时进入死信队列
+	waitFor(t, "dead letter", func() bool { return broker.QueueLen("jobs.dead") == 1 })
+}
+
+func TestWorkerPoolRunsConcurrently(t *testing.T) {
+	_, mq := newMQ(t)
+	declareQueue(t, mq, "jobs", nil)
+	const workers = 4
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+	var arrived int
+	done := make(chan struct{}, workers*2)
+	go mq.Consume(1, func(body []byte) rabbitMQ.ConsumeResult {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		// 第一批消息等待所有协程都开始处理
+		mu.Lock()
+		arrived++
+		deadline := time.Now().Add(waitTimeout)
+		for arrived < workers && time.Now().Before(deadline) {
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+		}
+		mu.Unlock()
+		atomic.AddInt32(&inFlight, -1)
+		done <- struct{}{}
+		return rabbitMQ.ConsumeResult{}
+	}, &rabbitMQ.ConsumeConfig{ConsumeQueue: "jobs", Workers: workers})
+	for i := 0; i < workers*2; i++ {
+		if err := mq.Publish([]byte(strconv.Itoa(i)), &rabbitMQ.PublishConfig{RoutingKey: "jobs"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "all handled", func() bool { return len(done) == workers*2 })
+	if m := atomic.LoadInt32(&maxInFlight); m != workers {
+		t.Fatalf("max in flight = %d, want %d", m, workers)
+	}
+}
+
+func TestWorkerPoolKeepsPartitionOrder(t *testing.T) {
+	_, mq := newMQ(t)
+	declareQueue(t, mq, "jobs", nil)
+	var mu sync.Mutex
+	seen := make(map[string][]int)
+	var total int32
+	go mq.ConsumeDelivery(3, func(ctx context.Context, d *amqp.Delivery) rabbitMQ.ConsumeResult {
+		key, seq, _ := strings.Cut(string(d.Body), ":")
+		n, _ := strconv.Atoi(seq)
+		// 处理耗时不同，打乱不同分区之间的完成顺序
+		time.Sleep(time.Duration(n%3) * time.Millisecond)
+		mu.Lock()
+		seen[key] = append(seen[key], n)
+		mu.Unlock()
+		atomic.AddInt32(&total, 1)
+		return rabbitMQ.ConsumeResult{}
+	}, &rabbitMQ.ConsumeConfig{
+		ConsumeQueue: "jobs",
+		Workers:      4,
+		PartitionKey: func(d *amqp.Delivery) string {
+			key, _, _ := strings.Cut(string(d.Body), ":")
+			return key
+		},
+	})
+	keys := []string{"a", "b", "c", "d", "e"}
+	const perKey = 10
+	for i := 0; i < perKey; i++ {
+		for _, key := range keys {
+			if err := mq.Publish([]byte(fmt.Sprintf("%s:%d", key, i)), &rabbitMQ.PublishConfig{RoutingKey: "jobs"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	waitFor(t, "all handled", func() bool { return atomic.LoadInt32(&total) == int32(len(keys)*perKey) })
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		got := seen[key]
+		for i, n := range got {
+			if n != i {
+				t.Fatalf("partition %s order = %v, want ascending", key, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,500 @@
+// Package mqtest 提供内存实现的 AMQP 代理，用于在没有 RabbitMQ 服务的情况下测试 rabbitMQ 的使用方：
+//
+//	broker := mqtest.New()
+//	mq, _ := rabbitMQ.New(&rabbitMQ.RabbitConfig{DialStr: []string{"amqp://mqtest"}, Dial: broker.Dial})
+//
+// 支持 direct、fanout、topic、headers 交换器，交换器之间的绑定，ack/nack/reject 及重新入队，
+// prefetch，消息和队列 TTL，死信（含 x-death 消息头及循环检测），publisher confirms 和 direct reply-to。
+// 与 RabbitMQ 一致，大多数错误只关闭 channel，声明未知类型的交换器会关闭整个连接
+package mqtest
+
+import (
+	"fmt"
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"github.com/streadway/amqp"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// direct reply-to 伪队列
+const replyToQueue = "amq.rabbitmq.reply-to"
+
+// Message 队列中待投递的消息
+type Message struct {
+	Exchange    string
+	RoutingKey  string
+	Redelivered bool
+	amqp.Publishing
+}
+
+// Broker 内存 AMQP 代理
+type Broker struct {
+	mu        sync.Mutex
+	exchanges map[string]*exchange
+	queues    map[string]*queue
+	conns     map[*connection]bool
+	seq       uint64
+}
+
+type exchange struct {
+	name       string
+	kind       string
+	durable    bool
+	autoDelete bool
+	internal   bool
+	bindings   []binding
+}
+
+type binding struct {
+	destination string
+	toExchange  bool
+	key         string
+	args        amqp.Table
+}
+
+type queue struct {
+	name       string
+	durable    bool
+	autoDelete bool
+	exclusive  *connection
+	args       amqp.Table
+	messages   []*message
+	consumers  []*consumer
+	next       int
+}
+
+type message struct {
+	exchange    string
+	routingKey  string
+	redelivered bool
+	ttl         int64
+	expireAt    time.Time
+	publishing  amqp.Publishing
+}
+
+// New 创建内存代理，预先声明 amq.direct、amq.fanout、amq.topic、amq.headers 交换器
+func New() *Broker {
+	b := &Broker{
+		exchanges: make(map[string]*exchange),
+		queues:    make(map[string]*queue),
+		conns:     make(map[*connection]bool),
+	}
+	for _, kind := range []string{amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic, amqp.ExchangeHeaders} {
+		b.exchanges["amq."+kind] = &exchange{name: "amq." + kind, kind: kind, durable: true}
+	}
+	return b
+}
+
+// Dial 建立连接，可作为 rabbitMQ.RabbitConfig.Dial 使用
+func (b *Broker) Dial(url string) (rabbitMQ.Connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := &connection{broker: b, channels: make(map[*channel]bool)}
+	b.conns[c] = true
+	return c, nil
+}
+
+// Disconnect 模拟代理异常断开所有连接，用于测试重连
+func (b *Broker) Disconnect() {
+	b.mu.Lock()
+	var notify []func()
+	for c := range b.conns {
+		notify = append(notify, c.shutdown(&amqp.Error{Code: amqp.ConnectionForced, Reason: "CONNECTION_FORCED - broker forced connection closure", Server: true})...)
+	}
+	b.mu.Unlock()
+	for _, f := range notify {
+		f()
+	}
+}
+
+// QueueLen 队列中待投递的消息数
+func (b *Broker) QueueLen(name string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if q, ok := b.queues[name]; ok {
+		return len(q.messages)
+	}
+	return 0
+}
+
+// Messages 队列中待投递消息的快照
+func (b *Broker) Messages(name string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.queues[name]
+	if !ok {
+		return nil
+	}
+	messages := make([]Message, 0, len(q.messages))
+	for _, m := range q.messages {
+		messages = append(messages, Message{Exchange: m.exchange, RoutingKey: m.routingKey, Redelivered: m.redelivered, Publishing: m.publishing})
+	}
+	return messages
+}
+
+// Purge 清空队列，返回清除的消息数
+func (b *Broker) Purge(name string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.queues[name]
+	if !ok {
+		return 0
+	}
+	n := len(q.messages)
+	q.messages = nil
+	return n
+}
+
+// HasQueue 队列是否存在
+func (b *Broker) HasQueue(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.queues[name]
+	return ok
+}
+
+// HasExchange 交换器是否存在
+func (b *Broker) HasExchange(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.exchanges[name]
+	return ok
+}
+
+// nextId 生成递增序号
+func (b *Broker) nextId() uint64 {
+	b.seq++
+	return b.seq
+}
+
+// route 计算消息路由到的队列，支持交换器之间的绑定
+func (b *Broker) route(exchangeName, key string, headers amqp.Table) []*queue {
+	if exchangeName == "" {
+		if q, ok := b.queues[key]; ok {
+			return []*queue{q}
+		}
+		return nil
+	}
+	var queues []*queue
+	matched := make(map[*queue]bool)
+	visited := make(map[string]bool)
+	var walk func(name string)
+	walk = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		ex, ok := b.exchanges[name]
+		if !ok {
+			return
+		}
+		for _, bd := range ex.bindings {
+			if !ex.matches(bd, key, headers) {
+				continue
+			}
+			if bd.toExchange {
+				walk(bd.destination)
+			} else if q, ok := b.queues[bd.destination]; ok && !matched[q] {
+				matched[q] = true
+				queues = append(queues, q)
+			}
+		}
+	}
+	walk(exchangeName)
+	return queues
+}
+
+// matches 绑定是否匹配
+func (ex *exchange) matches(bd binding, key string, headers amqp.Table) bool {
+	switch ex.kind {
+	case amqp.ExchangeFanout:
+		return true
+	case amqp.ExchangeTopic:
+		return topicMatch(strings.Split(bd.key, "."), strings.Split(key, "."))
+	case amqp.ExchangeHeaders:
+		return headersMatch(bd.args, headers)
+	default:
+		return bd.key == key
+	}
+}
+
+// topicMatch topic 路由匹配，* 匹配一个单词，# 匹配零个或多个单词
+func topicMatch(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if topicMatch(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && topicMatch(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && topicMatch(pattern[1:], words[1:])
+	}
+}
+
+// headersMatch headers 路由匹配，x-match 默认 all，忽略 x- 开头的绑定参数
+func headersMatch(args, headers amqp.Table) bool {
+	matchAny := args["x-match"] == "any"
+	var checked int
+	for k, v := range args {
+		if strings.HasPrefix(k, "x-") {
+			continue
+		}
+		checked++
+		hv, ok := headers[k]
+		// 绑定值为空时只要求消息头存在
+		matched := ok && (v == nil || reflect.DeepEqual(normalize(v), normalize(hv)))
+		if matchAny && matched {
+			return true
+		}
+		if !matchAny && !matched {
+			return false
+		}
+	}
+	return !matchAny || checked == 0
+}
+
+// normalize 统一整数类型，便于比较参数
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	}
+	return v
+}
+
+// tableEqual 比较声明参数
+func tableEqual(a, b amqp.Table) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		bv, ok := b[k]
+		if !ok || !reflect.DeepEqual(normalize(v), normalize(bv)) {
+			return false
+		}
+	}
+	return true
+}
+
+// int64Arg 读取整数参数
+func int64Arg(args amqp.Table, key string) (int64, bool) {
+	switch n := normalize(args[key]).(type) {
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// enqueue 消息入队，设置过期时间
+func (b *Broker) enqueue(q *queue, m *message) {
+	ttl := int64(-1)
+	if n, ok := int64Arg(q.args, "x-message-ttl"); ok {
+		ttl = n
+	}
+	if m.publishing.Expiration != "" {
+		if n, err := strconv.ParseInt(m.publishing.Expiration, 10, 64); err == nil && (ttl < 0 || n < ttl) {
+			ttl = n
+		}
+	}
+	if ttl >= 0 {
+		m.ttl = ttl
+		m.expireAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+			b.mu.Lock()
+			b.expire(q)
+			b.mu.Unlock()
+		})
+	}
+	q.messages = append(q.messages, m)
+}
+
+// publish 路由并投递消息
+func (b *Broker) publish(exchangeName, key string, pub amqp.Publishing) {
+	b.publishTo(b.route(exchangeName, key, pub.Headers), exchangeName, key, pub)
+}
+
+// publishTo 投递消息到已路由的队列
+func (b *Broker) publishTo(queues []*queue, exchangeName, key string, pub amqp.Publishing) {
+	for _, q := range queues {
+		m := &message{exchange: exchangeName, routingKey: key, publishing: pub}
+		m.publishing.Headers = copyTable(pub.Headers)
+		b.enqueue(q, m)
+	}
+	for _, q := range queues {
+		b.dispatch(q)
+		b.expire(q)
+	}
+}
+
+// expire 队列中过期的消息进入死信
+func (b *Broker) expire(q *queue) {
+	if b.queues[q.name] != q {
+		return
+	}
+	now := time.Now()
+	remain := q.messages[:0]
+	var expired []*message
+	for _, m := range q.messages {
+		if !m.expireAt.IsZero() && !m.expireAt.After(now) {
+			expired = append(expired, m)
+		} else {
+			remain = append(remain, m)
+		}
+	}
+	q.messages = remain
+	for _, m := range expired {
+		b.deadLetter(q, m, "expired")
+	}
+}
+
+// deadLetter 按队列的 x-dead-letter-exchange 投递死信，记录 x-death 消息头
+func (b *Broker) deadLetter(q *queue, m *message, reason string) {
+	dlx, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+	key := m.routingKey
+	if dlk, ok := q.args["x-dead-letter-routing-key"].(string); ok {
+		key = dlk
+	}
+	pub := m.publishing
+	pub.Headers = copyTable(m.publishing.Headers)
+	if pub.Headers == nil {
+		pub.Headers = amqp.Table{}
+	}
+	deaths, _ := pub.Headers["x-death"].([]interface{})
+	count := int64(1)
+	rest := make([]interface{}, 0, len(deaths)+1)
+	for _, v := range deaths {
+		death, ok := v.(amqp.Table)
+		if ok && death["queue"] == q.name && death["reason"] == reason {
+			if n, ok := death["count"].(int64); ok {
+				count = n + 1
+			}
+			continue
+		}
+		rest = append(rest, v)
+	}
+	death := amqp.Table{
+		"count":        count,
+		"reason":       reason,
+		"queue":        q.name,
+		"time":         time.Now(),
+		"exchange":     m.exchange,
+		"routing-keys": []interface{}{m.routingKey},
+	}
+	if pub.Expiration != "" {
+		death["original-expiration"] = pub.Expiration
+		pub.Expiration = ""
+	}
+	deaths = append([]interface{}{death}, rest...)
+	pub.Headers["x-death"] = deaths
+	// 与 RabbitMQ 一致，死信循环中没有被拒绝的环节时丢弃消息，避免 TTL 为 0 时无限循环
+	queues := b.route(dlx, key, pub.Headers)
+	targets := queues[:0]
+	for _, target := range queues {
+		if !deadLetterCycle(deaths, target.name) {
+			targets = append(targets, target)
+		}
+	}
+	b.publishTo(targets, dlx, key, pub)
+}
+
+// deadLetterCycle 消息是否曾从 queueName 成为死信，且期间没有被拒绝
+func deadLetterCycle(deaths []interface{}, queueName string) bool {
+	cycle := false
+	for _, v := range deaths {
+		death, ok := v.(amqp.Table)
+		if !ok {
+			continue
+		}
+		if death["reason"] == "rejected" {
+			return false
+		}
+		if death["queue"] == queueName {
+			cycle = true
+		}
+	}
+	return cycle
+}
+
+// dispatch 将待投递消息按轮询分发给有空闲 prefetch 的消费者
+func (b *Broker) dispatch(q *queue) {
+	for len(q.messages) > 0 {
+		var target *consumer
+		for i := 0; i < len(q.consumers); i++ {
+			c := q.consumers[(q.next+i)%len(q.consumers)]
+			if c.ready() {
+				target = c
+				q.next = (q.next + i + 1) % len(q.consumers)
+				break
+			}
+		}
+		if target == nil {
+			return
+		}
+		m := q.messages[0]
+		q.messages = q.messages[1:]
+		// TTL 为 0 的消息只在入队时有一次投递机会，由 publish 随后处理过期
+		if m.ttl > 0 && !m.expireAt.After(time.Now()) {
+			b.deadLetter(q, m, "expired")
+			continue
+		}
+		target.deliver(q, m)
+	}
+}
+
+// deleteQueue 删除队列及指向它的绑定
+func (b *Broker) deleteQueue(q *queue) {
+	delete(b.queues, q.name)
+	for _, ex := range b.exchanges {
+		bindings := ex.bindings[:0]
+		for _, bd := range ex.bindings {
+			if bd.toExchange || bd.destination != q.name {
+				bindings = append(bindings, bd)
+			}
+		}
+		ex.bindings = bindings
+	}
+}
+
+// copyTable 复制消息头
+func copyTable(t amqp.Table) amqp.Table {
+	if t == nil {
+		return nil
+	}
+	c := make(amqp.Table, len(t))
+	for k, v := range t {
+		c[k] = v
+	}
+	return c
+}
+
+// amqpError 生成 channel 异常
+func amqpError(code int, format string, args ...interface{}) *amqp.Error {
+	return &amqp.Error{Code: code, Reason: fmt.Sprintf(format, args...), Server: true}
+}
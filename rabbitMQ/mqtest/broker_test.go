@@ -0,0 +1,376 @@
+package mqtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"github.com/streadway/amqp"
+)
+
+// 等待投递的超时时间
+const waitTimeout = time.Second
+
+func openChannel(t *testing.T, b *Broker) rabbitMQ.Channel {
+	t.Helper()
+	conn, err := b.Dial("amqp://mqtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ch
+}
+
+func declareQueue(t *testing.T, ch rabbitMQ.Channel, name string, args amqp.Table) {
+	t.Helper()
+	if _, err := ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+		t.Fatalf("declare queue %s: %v", name, err)
+	}
+}
+
+func publish(t *testing.T, ch rabbitMQ.Channel, exchange, key string, msg amqp.Publishing) {
+	t.Helper()
+	if err := ch.Publish(exchange, key, false, false, msg); err != nil {
+		t.Fatalf("publish %s/%s: %v", exchange, key, err)
+	}
+}
+
+func consume(t *testing.T, ch rabbitMQ.Channel, queue string) <-chan amqp.Delivery {
+	t.Helper()
+	deliveries, err := ch.Consume(queue, "", false, false, false, false, nil)
+	if err != nil {
+		t.Fatalf("consume %s: %v", queue, err)
+	}
+	return deliveries
+}
+
+func receive(t *testing.T, deliveries <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(waitTimeout):
+		t.Fatal("no delivery")
+	}
+	return amqp.Delivery{}
+}
+
+func amqpCode(err error) int {
+	var e *amqp.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return 0
+}
+
+func TestTopicRouting(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	if err := ch.ExchangeDeclare("events", amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	bindings := map[string]string{"all": "#", "single": "order.*", "multi": "order.#"}
+	for queue, key := range bindings {
+		declareQueue(t, ch, queue, nil)
+		if err := ch.QueueBind(queue, key, "events", false, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish(t, ch, "events", "order.created.v1", amqp.Publishing{})
+	publish(t, ch, "events", "order", amqp.Publishing{})
+	publish(t, ch, "events", "order.paid", amqp.Publishing{})
+	// * 只匹配一个单词，# 匹配零个或多个单词
+	want := map[string]int{"all": 3, "single": 1, "multi": 3}
+	for queue, n := range want {
+		if got := b.QueueLen(queue); got != n {
+			t.Errorf("queue %s len = %d, want %d", queue, got, n)
+		}
+	}
+}
+
+func TestHeadersRouting(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	declareQueue(t, ch, "all", nil)
+	declareQueue(t, ch, "any", nil)
+	if err := ch.QueueBind("all", "", "amq.headers", false, amqp.Table{"x-match": "all", "type": "order", "v": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.QueueBind("any", "", "amq.headers", false, amqp.Table{"x-match": "any", "type": "order", "v": 1}); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, ch, "amq.headers", "", amqp.Publishing{Headers: amqp.Table{"type": "order", "v": int64(1)}})
+	publish(t, ch, "amq.headers", "", amqp.Publishing{Headers: amqp.Table{"type": "order"}})
+	if got := b.QueueLen("all"); got != 1 {
+		t.Errorf("x-match all len = %d, want 1", got)
+	}
+	if got := b.QueueLen("any"); got != 2 {
+		t.Errorf("x-match any len = %d, want 2", got)
+	}
+}
+
+func TestDefaultExchangeRoutesByQueueName(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	declareQueue(t, ch, "jobs", nil)
+	publish(t, ch, "", "jobs", amqp.Publishing{Body: []byte("a")})
+	publish(t, ch, "", "missing", amqp.Publishing{Body: []byte("b")})
+	if got := b.QueueLen("jobs"); got != 1 {
+		t.Fatalf("jobs len = %d, want 1", got)
+	}
+}
+
+func TestInequivalentQueueDeclareClosesChannel(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	declareQueue(t, ch, "jobs", amqp.Table{"x-message-ttl": int32(1000)})
+	// 整数类型不同但值相同视为一致
+	declareQueue(t, ch, "jobs", amqp.Table{"x-message-ttl": int64(1000)})
+	_, err := ch.QueueDeclare("jobs", true, false, false, false, amqp.Table{"x-message-ttl": int64(2000)})
+	if code := amqpCode(err); code != amqp.PreconditionFailed {
+		t.Fatalf("redeclare err = %v, want code %d", err, amqp.PreconditionFailed)
+	}
+	if err = ch.Publish("", "jobs", false, false, amqp.Publishing{}); err != amqp.ErrClosed {
+		t.Fatalf("publish on closed channel err = %v, want %v", err, amqp.ErrClosed)
+	}
+}
+
+func TestPublishToMissingExchange(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	err := ch.Publish("missing", "", false, false, amqp.Publishing{})
+	if code := amqpCode(err); code != amqp.NotFound {
+		t.Fatalf("publish err = %v, want code %d", err, amqp.NotFound)
+	}
+}
+
+func TestNackRequeueRedelivers(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	declareQueue(t, ch, "jobs", nil)
+	deliveries := consume(t, ch, "jobs")
+	publish(t, ch, "", "jobs", amqp.Publishing{MessageId: "m1"})
+	d := receive(t, deliveries)
+	if d.Redelivered {
+		t.Fatal("first delivery marked redelivered")
+	}
+	if err := d.Nack(false, true); err != nil {
+		t.Fatal(err)
+	}
+	d = receive(t, deliveries)
+	if !d.Redelivered || d.MessageId != "m1" {
+		t.Fatalf("requeued delivery = %s redelivered %v, want m1 redelivered", d.MessageId, d.Redelivered)
+	}
+	if err := d.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	// 重复确认同一个 delivery tag 是 channel 异常
+	if code := amqpCode(d.Ack(false)); code != amqp.PreconditionFailed {
+		t.Fatalf("double ack code = %d, want %d", code, amqp.PreconditionFailed)
+	}
+}
+
+func TestPrefetchLimitsUnacked(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	declareQueue(t, ch, "jobs", nil)
+	if err := ch.Qos(1, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	deliveries := consume(t, ch, "jobs")
+	publish(t, ch, "", "jobs", amqp.Publishing{MessageId: "m1"})
+	publish(t, ch, "", "jobs", amqp.Publishing{MessageId: "m2"})
+	d := receive(t, deliveries)
+	select {
+	case extra := <-deliveries:
+		t.Fatalf("delivered %s beyond prefetch", extra.MessageId)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := d.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	if d = receive(t, deliveries); d.MessageId != "m2" {
+		t.Fatalf("second delivery = %s, want m2", d.MessageId)
+	}
+}
+
+func TestPublisherConfirms(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	declareQueue(t, ch, "jobs", nil)
+	if err := ch.Confirm(false); err != nil {
+		t.Fatal(err)
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 2))
+	publish(t, ch, "", "jobs", amqp.Publishing{})
+	publish(t, ch, "", "jobs", amqp.Publishing{})
+	for tag := uint64(1); tag <= 2; tag++ {
+		c := <-confirms
+		if c.DeliveryTag != tag || !c.Ack {
+			t.Fatalf("confirm = %+v, want tag %d acked", c, tag)
+		}
+	}
+}
+
+// deathCount x-death 中 queue、reason 对应的次数
+func deathCount(headers amqp.Table, queue, reason string) int64 {
+	deaths, _ := headers["x-death"].([]interface{})
+	for _, v := range deaths {
+		death, ok := v.(amqp.Table)
+		if ok && death["queue"] == queue && death["reason"] == reason {
+			n, _ := death["count"].(int64)
+			return n
+		}
+	}
+	return 0
+}
+
+func TestDeadLetterRejected(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	declareQueue(t, ch, "jobs", amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "jobs.dead"})
+	declareQueue(t, ch, "jobs.dead", nil)
+	deliveries := consume(t, ch, "jobs")
+	publish(t, ch, "", "jobs", amqp.Publishing{MessageId: "m1"})
+	if err := receive(t, deliveries).Nack(false, false); err != nil {
+		t.Fatal(err)
+	}
+	messages := b.Messages("jobs.dead")
+	if len(messages) != 1 {
+		t.Fatalf("dead letter len = %d, want 1", len(messages))
+	}
+	if n := deathCount(messages[0].Headers, "jobs", "rejected"); n != 1 {
+		t.Fatalf("x-death count = %d, want 1", n)
+	}
+}
+
+func TestMessageTTLDeadLetter(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	declareQueue(t, ch, "delay", amqp.Table{"x-message-ttl": int64(20), "x-dead-letter-exchange": "", "x-dead-letter-routing-key": "ready"})
+	declareQueue(t, ch, "ready", nil)
+	// 消息级别的 Expiration 与队列 TTL 取较小值
+	publish(t, ch, "", "delay", amqp.Publishing{MessageId: "m1", Expiration: "60000"})
+	if got := b.QueueLen("ready"); got != 0 {
+		t.Fatalf("ready len before ttl = %d, want 0", got)
+	}
+	deadline := time.Now().Add(waitTimeout)
+	for b.QueueLen("ready") == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	messages := b.Messages("ready")
+	if len(messages) != 1 {
+		t.Fatalf("ready len = %d, want 1", len(messages))
+	}
+	if messages[0].Expiration != "" {
+		t.Fatalf("dead letter expiration = %q, want removed", messages[0].Expiration)
+	}
+	if n := deathCount(messages[0].Headers, "delay", "expired"); n != 1 {
+		t.Fatalf("x-death count = %d, want 1", n)
+	}
+}
+
+func TestDeadLetterCycleWithoutRejectionIsDropped(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	// 自身循环：过期后死信回到同一个队列
+	declareQueue(t, ch, "self", amqp.Table{"x-message-ttl": int64(0), "x-dead-letter-exchange": ""})
+	// 两个队列相互循环
+	declareQueue(t, ch, "a", amqp.Table{"x-message-ttl": int64(0), "x-dead-letter-exchange": "", "x-dead-letter-routing-key": "b"})
+	declareQueue(t, ch, "b", amqp.Table{"x-message-ttl": int64(0), "x-dead-letter-exchange": "", "x-dead-letter-routing-key": "a"})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		publish(t, ch, "", "self", amqp.Publishing{})
+		publish(t, ch, "", "a", amqp.Publishing{})
+	}()
+	select {
+	case <-done:
+	case <-time.After(waitTimeout):
+		t.Fatal("dead letter cycle did not terminate")
+	}
+	for _, queue := range []string{"self", "a", "b"} {
+		if got := b.QueueLen(queue); got != 0 {
+			t.Errorf("queue %s len = %d, want 0", queue, got)
+		}
+	}
+}
+
+func TestDeadLetterCycleWithRejectionIsKept(t *testing.T) {
+	b := New()
+	ch := openChannel(t, b)
+	// 重试模式：拒绝后进入延迟队列，过期后回到工作队列
+	declareQueue(t, ch, "work", amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "retry"})
+	declareQueue(t, ch, "retry", amqp.Table{"x-message-ttl": int64(0), "x-dead-letter-exchange": "", "x-dead-letter-routing-key": "work"})
+	deliveries := consume(t, ch, "work")
+	publish(t, ch, "", "work", amqp.Publishing{MessageId: "m1"})
+	for attempt := int64(1); attempt <= 3; attempt++ {
+		d := receive(t, deliveries)
+		if n := deathCount(d.Headers, "work", "rejected"); n != attempt-1 {
+			t.Fatalf("attempt %d rejected count = %d, want %d", attempt, n, attempt-1)
+		}
+		if err := d.Nack(false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := receive(t, deliveries)
+	if n := deathCount(d.Headers, "retry", "expired"); n != 3 {
+		t.Fatalf("expired count = %d, want 3", n)
+	}
+	if err := d.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnknownExchangeTypeClosesConnection(t *testing.T) {
+	b := New()
+	conn, err := b.Dial("amqp://mqtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	declareQueue(t, other, "jobs", nil)
+	deliveries := consume(t, other, "jobs")
+	err = ch.ExchangeDeclare("delayed", "x-delayed-message", true, false, false, false, nil)
+	if code := amqpCode(err); code != amqp.CommandInvalid {
+		t.Fatalf("declare err = %v, want code %d", err, amqp.CommandInvalid)
+	}
+	// 连接级别的错误关闭同一连接上的所有 channel 和消费者
+	select {
+	case e := <-closed:
+		if e == nil || e.Code != amqp.CommandInvalid {
+			t.Fatalf("connection close err = %v, want code %d", e, amqp.CommandInvalid)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("connection not closed")
+	}
+	if err = other.Publish("", "jobs", false, false, amqp.Publishing{}); err != amqp.ErrClosed {
+		t.Fatalf("publish on other channel err = %v, want %v", err, amqp.ErrClosed)
+	}
+	select {
+	case _, ok := <-deliveries:
+		if ok {
+			t.Fatal("unexpected delivery")
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("consumer not closed")
+	}
+	if _, err = conn.Channel(); err != amqp.ErrClosed {
+		t.Fatalf("open channel err = %v, want %v", err, amqp.ErrClosed)
+	}
+	// 其他连接不受影响
+	declareQueue(t, openChannel(t, b), "other", nil)
+}
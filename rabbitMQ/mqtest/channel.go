@@ -0,0 +1,646 @@
+package mqtest
+
+import (
+	"fmt"
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"github.com/streadway/amqp"
+	"strings"
+	"sync"
+)
+
+// connection 内存连接
+type connection struct {
+	broker   *Broker
+	channels map[*channel]bool
+	notify   []chan *amqp.Error
+	closed   bool
+}
+
+func (c *connection) Channel() (rabbitMQ.Channel, error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	ch := &channel{
+		conn:     c,
+		broker:   b,
+		unacked:  make(map[uint64]*delivery),
+		consumer: make(map[string]*consumer),
+	}
+	c.channels[ch] = true
+	return ch, nil
+}
+
+func (c *connection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		close(receiver)
+	} else {
+		c.notify = append(c.notify, receiver)
+	}
+	return receiver
+}
+
+func (c *connection) Close() error {
+	c.broker.mu.Lock()
+	if c.closed {
+		c.broker.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	notify := c.shutdown(nil)
+	c.broker.mu.Unlock()
+	for _, f := range notify {
+		f()
+	}
+	return nil
+}
+
+// shutdown 关闭连接及其所有 channel，删除独占队列，返回需要在释放锁后执行的通知
+func (c *connection) shutdown(err *amqp.Error) []func() {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	delete(c.broker.conns, c)
+	var notify []func()
+	for ch := range c.channels {
+		notify = append(notify, ch.shutdown(err)...)
+	}
+	for _, q := range c.broker.queues {
+		if q.exclusive == c {
+			c.broker.deleteQueue(q)
+		}
+	}
+	receivers := c.notify
+	c.notify = nil
+	notify = append(notify, func() {
+		closeNotify(receivers, err)
+	})
+	return notify
+}
+
+// closeNotify 发送关闭原因并关闭监听 channel，正常关闭时只关闭
+func closeNotify(receivers []chan *amqp.Error, err *amqp.Error) {
+	for _, r := range receivers {
+		if err != nil {
+			select {
+			case r <- err:
+			default:
+			}
+		}
+		close(r)
+	}
+}
+
+// delivery 已投递未确认的消息
+type delivery struct {
+	queue    *queue
+	message  *message
+	consumer *consumer
+}
+
+// channel 内存 channel，同时作为投递消息的 Acknowledger
+type channel struct {
+	conn       *connection
+	broker     *Broker
+	closed     bool
+	prefetch   int
+	tag        uint64
+	unacked    map[uint64]*delivery
+	consumer   map[string]*consumer
+	notify     []chan *amqp.Error
+	confirming bool
+	publishSeq uint64
+	confirms   []chan amqp.Confirmation
+	replyQueue string
+}
+
+// fail 模拟 channel 异常：关闭 channel 并返回错误，调用时持有锁
+func (ch *channel) fail(code int, format string, args ...interface{}) ([]func(), error) {
+	err := amqpError(code, format, args...)
+	return ch.shutdown(err), err
+}
+
+// failConnection 模拟连接异常：关闭 channel 所在的连接及其所有 channel 并返回错误，调用时持有锁
+func (ch *channel) failConnection(code int, format string, args ...interface{}) ([]func(), error) {
+	err := amqpError(code, format, args...)
+	return ch.conn.shutdown(err), err
+}
+
+// shutdown 关闭 channel，未确认的消息重新入队
+func (ch *channel) shutdown(err *amqp.Error) []func() {
+	if ch.closed {
+		return nil
+	}
+	ch.closed = true
+	delete(ch.conn.channels, ch)
+	b := ch.broker
+	for tag, d := range ch.unacked {
+		delete(ch.unacked, tag)
+		d.consumer.unacked--
+		d.message.redelivered = true
+		d.queue.messages = append([]*message{d.message}, d.queue.messages...)
+	}
+	queues := make(map[*queue]bool)
+	for _, c := range ch.consumer {
+		c.cancel()
+		queues[c.queue] = true
+	}
+	ch.consumer = nil
+	for q := range queues {
+		if b.queues[q.name] == q {
+			b.dispatch(q)
+		}
+	}
+	receivers := ch.notify
+	ch.notify = nil
+	confirms := ch.confirms
+	ch.confirms = nil
+	return []func(){func() {
+		closeNotify(receivers, err)
+		for _, c := range confirms {
+			close(c)
+		}
+	}}
+}
+
+// unlock 释放锁并执行通知
+func (ch *channel) unlock(notify []func()) {
+	ch.broker.mu.Unlock()
+	for _, f := range notify {
+		f()
+	}
+}
+
+func (ch *channel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.prefetch = prefetchCount
+	return nil
+}
+
+func (ch *channel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	b := ch.broker
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	if exchange != "" {
+		ex, ok := b.exchanges[exchange]
+		if !ok {
+			notify, err := ch.fail(amqp.NotFound, "NOT_FOUND - no exchange '%s'", exchange)
+			ch.unlock(notify)
+			return err
+		}
+		if ex.internal {
+			notify, err := ch.fail(amqp.AccessRefused, "ACCESS_REFUSED - cannot publish to internal exchange '%s'", exchange)
+			ch.unlock(notify)
+			return err
+		}
+	}
+	if msg.ReplyTo == replyToQueue {
+		if ch.replyQueue == "" {
+			notify, err := ch.fail(amqp.PreconditionFailed, "PRECONDITION_FAILED - fast reply consumer does not exist")
+			ch.unlock(notify)
+			return err
+		}
+		msg.ReplyTo = ch.replyQueue
+	}
+	b.publish(exchange, key, msg)
+	var confirms []chan amqp.Confirmation
+	var seq uint64
+	if ch.confirming {
+		ch.publishSeq++
+		seq = ch.publishSeq
+		confirms = ch.confirms
+	}
+	b.mu.Unlock()
+	for _, c := range confirms {
+		c <- amqp.Confirmation{DeliveryTag: seq, Ack: true}
+	}
+	return nil
+}
+
+func (ch *channel) Consume(queueName, consumerTag string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	b := ch.broker
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return nil, amqp.ErrClosed
+	}
+	if queueName == replyToQueue {
+		if !autoAck {
+			notify, err := ch.fail(amqp.PreconditionFailed, "PRECONDITION_FAILED - reply consumer cannot acknowledge")
+			ch.unlock(notify)
+			return nil, err
+		}
+		ch.replyQueue = fmt.Sprintf("%s.g%d", replyToQueue, b.nextId())
+		b.queues[ch.replyQueue] = &queue{name: ch.replyQueue, autoDelete: true, exclusive: ch.conn}
+		queueName = ch.replyQueue
+	}
+	q, ok := b.queues[queueName]
+	if !ok {
+		notify, err := ch.fail(amqp.NotFound, "NOT_FOUND - no queue '%s'", queueName)
+		ch.unlock(notify)
+		return nil, err
+	}
+	if q.exclusive != nil && q.exclusive != ch.conn {
+		notify, err := ch.fail(amqp.ResourceLocked, "RESOURCE_LOCKED - cannot obtain exclusive access to locked queue '%s'", queueName)
+		ch.unlock(notify)
+		return nil, err
+	}
+	for _, c := range q.consumers {
+		if exclusive || c.exclusive {
+			notify, err := ch.fail(amqp.AccessRefused, "ACCESS_REFUSED - queue '%s' in exclusive use", queueName)
+			ch.unlock(notify)
+			return nil, err
+		}
+	}
+	if consumerTag == "" {
+		consumerTag = fmt.Sprintf("ctag-mqtest-%d", b.nextId())
+	}
+	c := newConsumer(ch, q, consumerTag, autoAck, exclusive, ch.prefetch)
+	ch.consumer[consumerTag] = c
+	q.consumers = append(q.consumers, c)
+	b.dispatch(q)
+	b.mu.Unlock()
+	return c.out, nil
+}
+
+func (ch *channel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	switch kind {
+	case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic, amqp.ExchangeHeaders:
+	default:
+		// 与 RabbitMQ 一致，未知的交换器类型是连接级别的错误
+		notify, err := ch.failConnection(amqp.CommandInvalid, "COMMAND_INVALID - unknown exchange type '%s'", kind)
+		ch.unlock(notify)
+		return err
+	}
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind || ex.durable != durable || ex.autoDelete != autoDelete || ex.internal != internal {
+			notify, err := ch.fail(amqp.PreconditionFailed, "PRECONDITION_FAILED - inequivalent arg for exchange '%s'", name)
+			ch.unlock(notify)
+			return err
+		}
+		b.mu.Unlock()
+		return nil
+	}
+	if name == "" || strings.HasPrefix(name, "amq.") {
+		notify, err := ch.fail(amqp.AccessRefused, "ACCESS_REFUSED - exchange name '%s' contains reserved prefix 'amq.*'", name)
+		ch.unlock(notify)
+		return err
+	}
+	b.exchanges[name] = &exchange{name: name, kind: kind, durable: durable, autoDelete: autoDelete, internal: internal}
+	b.mu.Unlock()
+	return nil
+}
+
+func (ch *channel) ExchangeDelete(name string, ifUnused, noWait bool) error {
+	b := ch.broker
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	ex, ok := b.exchanges[name]
+	if !ok {
+		notify, err := ch.fail(amqp.NotFound, "NOT_FOUND - no exchange '%s'", name)
+		ch.unlock(notify)
+		return err
+	}
+	if ifUnused && len(ex.bindings) > 0 {
+		notify, err := ch.fail(amqp.PreconditionFailed, "PRECONDITION_FAILED - exchange '%s' in use", name)
+		ch.unlock(notify)
+		return err
+	}
+	delete(b.exchanges, name)
+	for _, other := range b.exchanges {
+		bindings := other.bindings[:0]
+		for _, bd := range other.bindings {
+			if !bd.toExchange || bd.destination != name {
+				bindings = append(bindings, bd)
+			}
+		}
+		other.bindings = bindings
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+func (ch *channel) ExchangeBind(destination, key, source string, noWait bool, args amqp.Table) error {
+	return ch.bind(destination, true, key, source, args)
+}
+
+func (ch *channel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	b := ch.broker
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return amqp.Queue{}, amqp.ErrClosed
+	}
+	if name == "" {
+		name = fmt.Sprintf("amq.gen-mqtest-%d", b.nextId())
+	}
+	if q, ok := b.queues[name]; ok {
+		if q.exclusive != nil && q.exclusive != ch.conn {
+			notify, err := ch.fail(amqp.ResourceLocked, "RESOURCE_LOCKED - cannot obtain exclusive access to locked queue '%s'", name)
+			ch.unlock(notify)
+			return amqp.Queue{}, err
+		}
+		if q.durable != durable || q.autoDelete != autoDelete || (q.exclusive != nil) != exclusive || !tableEqual(q.args, args) {
+			notify, err := ch.fail(amqp.PreconditionFailed, "PRECONDITION_FAILED - inequivalent arg for queue '%s'", name)
+			ch.unlock(notify)
+			return amqp.Queue{}, err
+		}
+		state := amqp.Queue{Name: name, Messages: len(q.messages), Consumers: len(q.consumers)}
+		b.mu.Unlock()
+		return state, nil
+	}
+	if strings.HasPrefix(name, "amq.") {
+		notify, err := ch.fail(amqp.AccessRefused, "ACCESS_REFUSED - queue name '%s' contains reserved prefix 'amq.*'", name)
+		ch.unlock(notify)
+		return amqp.Queue{}, err
+	}
+	q := &queue{name: name, durable: durable, autoDelete: autoDelete, args: copyTable(args)}
+	if exclusive {
+		q.exclusive = ch.conn
+	}
+	b.queues[name] = q
+	b.mu.Unlock()
+	return amqp.Queue{Name: name}, nil
+}
+
+func (ch *channel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return ch.bind(name, false, key, exchange, args)
+}
+
+// bind 绑定队列或交换器到源交换器
+func (ch *channel) bind(destination string, toExchange bool, key, source string, args amqp.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	ex, ok := b.exchanges[source]
+	if !ok {
+		notify, err := ch.fail(amqp.NotFound, "NOT_FOUND - no exchange '%s'", source)
+		ch.unlock(notify)
+		return err
+	}
+	if toExchange {
+		_, ok = b.exchanges[destination]
+	} else {
+		_, ok = b.queues[destination]
+	}
+	if !ok {
+		notify, err := ch.fail(amqp.NotFound, "NOT_FOUND - no destination '%s'", destination)
+		ch.unlock(notify)
+		return err
+	}
+	for _, bd := range ex.bindings {
+		if bd.destination == destination && bd.toExchange == toExchange && bd.key == key && tableEqual(bd.args, args) {
+			b.mu.Unlock()
+			return nil
+		}
+	}
+	ex.bindings = append(ex.bindings, binding{destination: destination, toExchange: toExchange, key: key, args: copyTable(args)})
+	b.mu.Unlock()
+	return nil
+}
+
+func (ch *channel) Confirm(noWait bool) error {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.confirming = true
+	return nil
+}
+
+func (ch *channel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+	if ch.closed {
+		close(confirm)
+	} else {
+		ch.confirms = append(ch.confirms, confirm)
+	}
+	return confirm
+}
+
+func (ch *channel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+	if ch.closed {
+		close(receiver)
+	} else {
+		ch.notify = append(ch.notify, receiver)
+	}
+	return receiver
+}
+
+func (ch *channel) Close() error {
+	ch.broker.mu.Lock()
+	if ch.closed {
+		ch.broker.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	ch.unlock(ch.shutdown(nil))
+	return nil
+}
+
+// Ack 实现 amqp.Acknowledger
+func (ch *channel) Ack(tag uint64, multiple bool) error {
+	return ch.settle(tag, multiple, func(d *delivery) {})
+}
+
+// Nack 实现 amqp.Acknowledger
+func (ch *channel) Nack(tag uint64, multiple bool, requeue bool) error {
+	return ch.settle(tag, multiple, func(d *delivery) {
+		if requeue {
+			d.message.redelivered = true
+			d.queue.messages = append([]*message{d.message}, d.queue.messages...)
+		} else {
+			ch.broker.deadLetter(d.queue, d.message, "rejected")
+		}
+	})
+}
+
+// Reject 实现 amqp.Acknowledger
+func (ch *channel) Reject(tag uint64, requeue bool) error {
+	return ch.Nack(tag, false, requeue)
+}
+
+// settle 确认消息，并为释放 prefetch 的队列继续投递
+func (ch *channel) settle(tag uint64, multiple bool, fn func(d *delivery)) error {
+	b := ch.broker
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	var tags []uint64
+	if multiple {
+		for t := range ch.unacked {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+	} else if _, ok := ch.unacked[tag]; ok {
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		notify, err := ch.fail(amqp.PreconditionFailed, "PRECONDITION_FAILED - unknown delivery tag %d", tag)
+		ch.unlock(notify)
+		return err
+	}
+	queues := make(map[*queue]bool)
+	for _, t := range tags {
+		d := ch.unacked[t]
+		delete(ch.unacked, t)
+		d.consumer.unacked--
+		fn(d)
+		queues[d.queue] = true
+	}
+	for q := range queues {
+		if b.queues[q.name] == q {
+			b.dispatch(q)
+		}
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// consumer 消费者，通过缓冲协程投递消息，避免持有锁时阻塞
+type consumer struct {
+	ch        *channel
+	queue     *queue
+	tag       string
+	autoAck   bool
+	exclusive bool
+	prefetch  int
+	unacked   int
+	mu        sync.Mutex
+	buf       []amqp.Delivery
+	signal    chan struct{}
+	done      chan struct{}
+	out       chan amqp.Delivery
+}
+
+func newConsumer(ch *channel, q *queue, tag string, autoAck, exclusive bool, prefetch int) *consumer {
+	c := &consumer{
+		ch:        ch,
+		queue:     q,
+		tag:       tag,
+		autoAck:   autoAck,
+		exclusive: exclusive,
+		prefetch:  prefetch,
+		signal:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		out:       make(chan amqp.Delivery),
+	}
+	go c.run()
+	return c
+}
+
+// ready 是否可以继续投递
+func (c *consumer) ready() bool {
+	return c.autoAck || c.prefetch <= 0 || c.unacked < c.prefetch
+}
+
+// deliver 投递消息，调用时持有锁
+func (c *consumer) deliver(q *queue, m *message) {
+	c.ch.tag++
+	d := amqp.Delivery{
+		Acknowledger:    c.ch,
+		Headers:         copyTable(m.publishing.Headers),
+		ContentType:     m.publishing.ContentType,
+		ContentEncoding: m.publishing.ContentEncoding,
+		DeliveryMode:    m.publishing.DeliveryMode,
+		Priority:        m.publishing.Priority,
+		CorrelationId:   m.publishing.CorrelationId,
+		ReplyTo:         m.publishing.ReplyTo,
+		Expiration:      m.publishing.Expiration,
+		MessageId:       m.publishing.MessageId,
+		Timestamp:       m.publishing.Timestamp,
+		Type:            m.publishing.Type,
+		UserId:          m.publishing.UserId,
+		AppId:           m.publishing.AppId,
+		ConsumerTag:     c.tag,
+		MessageCount:    uint32(len(q.messages)),
+		DeliveryTag:     c.ch.tag,
+		Redelivered:     m.redelivered,
+		Exchange:        m.exchange,
+		RoutingKey:      m.routingKey,
+		Body:            m.publishing.Body,
+	}
+	if !c.autoAck {
+		c.unacked++
+		c.ch.unacked[d.DeliveryTag] = &delivery{queue: q, message: m, consumer: c}
+	}
+	c.mu.Lock()
+	c.buf = append(c.buf, d)
+	c.mu.Unlock()
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+}
+
+// cancel 取消消费者，调用时持有锁
+func (c *consumer) cancel() {
+	q := c.queue
+	for i, other := range q.consumers {
+		if other == c {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+	if q.next >= len(q.consumers) {
+		q.next = 0
+	}
+	if q.autoDelete && len(q.consumers) == 0 {
+		c.ch.broker.deleteQueue(q)
+	}
+	close(c.done)
+}
+
+// run 将缓冲的消息发送到 out，取消后关闭 out
+func (c *consumer) run() {
+	defer close(c.out)
+	for {
+		c.mu.Lock()
+		if len(c.buf) == 0 {
+			c.mu.Unlock()
+			select {
+			case <-c.signal:
+				continue
+			case <-c.done:
+				return
+			}
+		}
+		d := c.buf[0]
+		c.buf = c.buf[1:]
+		c.mu.Unlock()
+		select {
+		case c.out <- d:
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package rabbitMQ
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/streadway/amqp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// 发件箱消息状态
+const (
+	OutboxPending = 0
+	OutboxSent    = 1
+	// OutboxPublishing 已被投递器认领，认领超时后可被重新认领
+	OutboxPublishing = 2
+	// OutboxFailed 投递次数达到上限，不再重试，需人工处理
+	OutboxFailed = 3
+)
+
+const (
+	// 发件箱默认表名
+	outboxDefaultTable = "mq_outbox"
+	// 每批投递消息数
+	outboxDefaultBatchSize = 100
+	// 无待投递消息时的轮询间隔
+	outboxDefaultInterval = time.Second
+	// 等待 broker 确认的超时时间
+	outboxDefaultConfirmTimeout = 10 * time.Second
+	// 认领超时时间，投递器异常退出后消息在此之后可被重新认领
+	outboxDefaultClaimTimeout = time.Minute
+	// 最大投递次数
+	outboxDefaultMaxAttempts = 10
+	// 失败原因最大长度
+	outboxMaxErrorLen = 1024
+)
+
+// OutboxMessage 发件箱消息
+type OutboxMessage struct {
+	Id          uint64    `gorm:"primaryKey;autoIncrement;index:idx_status_id,priority:2"`
+	Exchange    string    `gorm:"size:255;not null;default:''"`
+	RoutingKey  string    `gorm:"size:255;not null;default:''"`
+	ContentType string    `gorm:"size:64;not null;default:''"`
+	MessageId   string    `gorm:"size:64;not null;default:''"`
+	Headers     []byte    `gorm:"type:blob"`
+	Body        []byte    `gorm:"type:mediumblob"`
+	Status      int8      `gorm:"not null;default:0;index:idx_status_id,priority:1"`
+	Attempts    int       `gorm:"not null;default:0"`
+	LastError   string    `gorm:"size:1024;not null;default:''"`
+	CreatedAt   time.Time `gorm:"not null"`
+	SentAt      *time.Time
+	// LockedUntil 认领截止时间
+	LockedUntil *time.Time
+}
+
+// Outbox 事务发件箱：消息与业务数据在同一个 MySQL 事务中写入，由 OutboxRelay 投递到 RabbitMQ
+type Outbox struct {
+	Table string
+}
+
+// NewOutbox 创建发件箱，table 为空时使用 mq_outbox
+func NewOutbox(table string) *Outbox {
+	if table == "" {
+		table = outboxDefaultTable
+	}
+	return &Outbox{Table: table}
+}
+
+// Migrate 创建发件箱表
+func (o *Outbox) Migrate(db *gorm.DB) error {
+	return db.Table(o.Table).AutoMigrate(&OutboxMessage{})
+}
+
+// Publish 在调用方的事务 tx 中写入待投递消息
+func (o *Outbox) Publish(tx *gorm.DB, payLoad []byte, p *PublishConfig) error {
+	msg := &OutboxMessage{
+		Exchange:    p.ExChangeName,
+		RoutingKey:  p.RoutingKey,
+		ContentType: p.ContentType,
+		MessageId:   p.MessageId,
+		Body:        payLoad,
+		CreatedAt:   time.Now(),
+	}
+	if msg.ContentType == "" {
+		msg.ContentType = "text/json"
+	}
+	if msg.MessageId == "" {
+		var err error
+		if msg.MessageId, err = newId(); err != nil {
+			return err
+		}
+	}
+	if p.SchemaVersion != "" {
+		headers, err := json.Marshal(map[string]interface{}{schemaVersionHeader: p.SchemaVersion})
+		if err != nil {
+			return err
+		}
+		msg.Headers = headers
+	}
+	return tx.Table(o.Table).Create(msg).Error
+}
+
+// OutboxRelay 发件箱投递器，使用 publisher confirms 确认投递成功后标记消息已发送。
+// 在短事务中使用 SELECT ... FOR UPDATE SKIP LOCKED（需要 MySQL 8.0+）认领一批消息，
+// 投递及等待确认在事务外进行，不长时间持有行锁；
+// 多个投递器实例可以同时运行，认领未超时的消息只会被一个实例处理；单个实例不可并发调用
+type OutboxRelay struct {
+	r              *RabbitMQ
+	db             *gorm.DB
+	outbox         *Outbox
+	channel        Channel
+	confirms       chan amqp.Confirmation
+	sequence       uint64
+	BatchSize      int
+	Interval       time.Duration
+	ConfirmTimeout time.Duration
+	// ClaimTimeout 认领超时时间，需大于 ConfirmTimeout，超时未完成的消息会被重新认领
+	ClaimTimeout time.Duration
+	// MaxAttempts 最大投递次数，达到后标记为 OutboxFailed，小于等于 0 时不限制
+	MaxAttempts int
+}
+
+// NewOutboxRelay 创建发件箱投递器
+func NewOutboxRelay(r *RabbitMQ, db *gorm.DB, o *Outbox) *OutboxRelay {
+	return &OutboxRelay{
+		r:              r,
+		db:             db,
+		outbox:         o,
+		BatchSize:      outboxDefaultBatchSize,
+		Interval:       outboxDefaultInterval,
+		ConfirmTimeout: outboxDefaultConfirmTimeout,
+		ClaimTimeout:   outboxDefaultClaimTimeout,
+		MaxAttempts:    outboxDefaultMaxAttempts,
+	}
+}
+
+// Run 持续投递，直到 ctx 取消
+func (o *OutboxRelay) Run(ctx context.Context) error {
+	defer o.closeChannel()
+	for {
+		n, err := o.RelayOnce(ctx)
+		if err != nil {
+			log.Println("outbox relay err:", err)
+		}
+		// 本批已满时立即继续，否则等待下一轮
+		if err == nil && n >= o.BatchSize {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(o.Interval):
+		}
+	}
+}
+
+// RelayOnce 投递一批消息，返回处理的消息数
+func (o *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	messages, err := o.claim(ctx)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+	acked, publishErr := o.publish(messages)
+	db := o.db.WithContext(ctx)
+	if len(acked) > 0 {
+		err = db.Table(o.outbox.Table).
+			Where("id IN ? AND status = ?", acked, OutboxPublishing).
+			Updates(map[string]interface{}{"status": OutboxSent, "sent_at": time.Now(), "locked_until": nil}).Error
+		if err != nil {
+			return len(messages), err
+		}
+	}
+	if publishErr != nil {
+		// 未确认的消息恢复为待投递，记录失败原因后由下一轮重试
+		ackedSet := make(map[uint64]bool, len(acked))
+		for _, id := range acked {
+			ackedSet[id] = true
+		}
+		failed := make([]uint64, 0, len(messages)-len(acked))
+		for _, m := range messages {
+			if !ackedSet[m.Id] {
+				failed = append(failed, m.Id)
+			}
+		}
+		if err = o.fail(db, failed, publishErr); err != nil {
+			return len(messages), err
+		}
+	}
+	return len(messages), nil
+}
+
+// claim 在短事务中认领一批待投递或认领超时的消息
+func (o *OutboxRelay) claim(ctx context.Context) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Table(o.outbox.Table).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND locked_until < ?)", OutboxPending, OutboxPublishing, now).
+			Order("id").
+			Limit(o.BatchSize).
+			Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+		ids := make([]uint64, 0, len(messages))
+		for _, m := range messages {
+			ids = append(ids, m.Id)
+		}
+		return tx.Table(o.outbox.Table).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{"status": OutboxPublishing, "locked_until": now.Add(o.ClaimTimeout)}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// fail 记录投递失败，投递次数达到上限的消息标记为 OutboxFailed
+func (o *OutboxRelay) fail(db *gorm.DB, ids []uint64, publishErr error) error {
+	errMsg := publishErr.Error()
+	if len(errMsg) > outboxMaxErrorLen {
+		errMsg = errMsg[:outboxMaxErrorLen]
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(o.outbox.Table).
+			Where("id IN ? AND status = ?", ids, OutboxPublishing).
+			Updates(map[string]interface{}{
+				"status":       OutboxPending,
+				"attempts":     gorm.Expr("attempts + 1"),
+				"last_error":   errMsg,
+				"locked_until": nil,
+			}).Error
+		if err != nil || o.MaxAttempts <= 0 {
+			return err
+		}
+		return tx.Table(o.outbox.Table).
+			Where("id IN ? AND status = ? AND attempts >= ?", ids, OutboxPending, o.MaxAttempts).
+			Update("status", OutboxFailed).Error
+	})
+}
+
+// publish 投递消息并等待 broker 确认，返回已确认的消息ID
+func (o *OutboxRelay) publish(messages []OutboxMessage) ([]uint64, error) {
+	ch, err := o.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	// 确认序号从 channel 打开后的第一条消息开始递增，tags 记录本批消息的序号
+	tags := make(map[uint64]uint64, len(messages))
+	var publishErr error
+	for i := range messages {
+		m := &messages[i]
+		msg := amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  m.ContentType,
+			MessageId:    m.MessageId,
+			Timestamp:    m.CreatedAt,
+			Body:         m.Body,
+		}
+		if len(m.Headers) > 0 {
+			var headers amqp.Table
+			if err = json.Unmarshal(m.Headers, &headers); err != nil {
+				publishErr = fmt.Errorf("outbox message %d headers: %w", m.Id, err)
+				continue
+			}
+			msg.Headers = headers
+		}
+		if err = ch.Publish(m.Exchange, m.RoutingKey, false, false, msg); err != nil {
+			publishErr = err
+			o.closeChannel()
+			break
+		}
+		o.sequence++
+		tags[o.sequence] = m.Id
+	}
+
+	acked := make([]uint64, 0, len(tags))
+	timeout := time.After(o.ConfirmTimeout)
+	for len(tags) > 0 {
+		select {
+		case confirm, ok := <-o.confirms:
+			if !ok {
+				o.closeChannel()
+				if publishErr == nil {
+					publishErr = fmt.Errorf("outbox channel closed before confirms")
+				}
+				return acked, publishErr
+			}
+			id, exists := tags[confirm.DeliveryTag]
+			if !exists {
+				continue
+			}
+			delete(tags, confirm.DeliveryTag)
+			if confirm.Ack {
+				acked = append(acked, id)
+			} else if publishErr == nil {
+				publishErr = fmt.Errorf("outbox message %d nacked by broker", id)
+			}
+		case <-timeout:
+			// 超时后序号无法再与消息对应，重新打开 channel
+			o.closeChannel()
+			return acked, fmt.Errorf("outbox wait confirms timeout")
+		}
+	}
+	return acked, publishErr
+}
+
+// openChannel 打开 confirm 模式的 channel
+func (o *OutboxRelay) openChannel() (Channel, error) {
+	if o.channel != nil {
+		return o.channel, nil
+	}
+	ch, err := o.r.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	if err = ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	o.channel = ch
+	o.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, o.BatchSize))
+	o.sequence = 0
+	return ch, nil
+}
+
+// closeChannel 关闭 channel
+func (o *OutboxRelay) closeChannel() {
+	if o.channel != nil {
+		o.channel.Close()
+		o.channel = nil
+	}
+}
@@ -0,0 +1,99 @@
+package rabbitMQ_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"gorm.io/gorm"
+)
+
+func TestOutboxRelayPublishesWithConfirms(t *testing.T) {
+	broker, mq := newMQ(t)
+	declareQueue(t, mq, "orders", nil)
+	db, store := newFakeDB(t)
+	outbox := rabbitMQ.NewOutbox("")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range []string{"m1", "m2"} {
+			if err := outbox.Publish(tx, []byte(id), &rabbitMQ.PublishConfig{RoutingKey: "orders", MessageId: id, SchemaVersion: "v1"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 认领未超时的消息由其他投递器处理，不会被重复认领
+	future := time.Now().Add(time.Hour)
+	if err = outbox.Publish(db, []byte("m3"), &rabbitMQ.PublishConfig{RoutingKey: "orders", MessageId: "m3"}); err != nil {
+		t.Fatal(err)
+	}
+	store.set(3, "status", int64(rabbitMQ.OutboxPublishing))
+	store.set(3, "locked_until", future)
+
+	relay := rabbitMQ.NewOutboxRelay(mq, db, outbox)
+	n, err := relay.RelayOnce(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("relay = %d, %v, want 2 messages", n, err)
+	}
+	messages := broker.Messages("orders")
+	if len(messages) != 2 {
+		t.Fatalf("orders len = %d, want 2", len(messages))
+	}
+	for i, m := range messages {
+		if want := []string{"m1", "m2"}[i]; m.MessageId != want || string(m.Body) != want || m.Headers["x-schema-version"] != "v1" {
+			t.Fatalf("message %d = %s %s %v, want %s with schema version", i, m.MessageId, m.Body, m.Headers, want)
+		}
+	}
+	for id := int64(1); id <= 2; id++ {
+		row := store.row(id)
+		if row["status"] != int64(rabbitMQ.OutboxSent) || row["sent_at"] == nil || row["locked_until"] != nil {
+			t.Fatalf("row %d = %v, want sent", id, row)
+		}
+	}
+	if row := store.row(3); row["status"] != int64(rabbitMQ.OutboxPublishing) {
+		t.Fatalf("row 3 status = %v, want still publishing", row["status"])
+	}
+
+	// 认领超时后重新认领
+	store.set(3, "locked_until", time.Now().Add(-time.Second))
+	if n, err = relay.RelayOnce(context.Background()); err != nil || n != 1 {
+		t.Fatalf("relay expired claim = %d, %v, want 1 message", n, err)
+	}
+	if row := store.row(3); row["status"] != int64(rabbitMQ.OutboxSent) {
+		t.Fatalf("row 3 status = %v, want sent", row["status"])
+	}
+	if n, err = relay.RelayOnce(context.Background()); err != nil || n != 0 {
+		t.Fatalf("relay without pending = %d, %v, want 0", n, err)
+	}
+}
+
+func TestOutboxRelayFailure(t *testing.T) {
+	_, mq := newMQ(t)
+	db, store := newFakeDB(t)
+	outbox := rabbitMQ.NewOutbox("")
+	// 交换器不存在，投递时 channel 被关闭
+	if err := outbox.Publish(db, []byte("{}"), &rabbitMQ.PublishConfig{ExChangeName: "missing", MessageId: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+	relay := rabbitMQ.NewOutboxRelay(mq, db, outbox)
+	relay.MaxAttempts = 2
+	for attempt := int64(1); attempt <= 2; attempt++ {
+		if n, err := relay.RelayOnce(context.Background()); err != nil || n != 1 {
+			t.Fatalf("relay attempt %d = %d, %v, want 1 message", attempt, n, err)
+		}
+		row := store.row(1)
+		if row["attempts"] != attempt || row["last_error"] == "" || row["locked_until"] != nil {
+			t.Fatalf("attempt %d row = %v, want failure recorded", attempt, row)
+		}
+	}
+	// 达到最大投递次数后不再认领
+	if row := store.row(1); row["status"] != int64(rabbitMQ.OutboxFailed) {
+		t.Fatalf("status = %v, want failed", row["status"])
+	}
+	if n, err := relay.RelayOnce(context.Background()); err != nil || n != 0 {
+		t.Fatalf("relay failed message = %d, %v, want 0", n, err)
+	}
+}
@@ -1,10 +1,12 @@
 package rabbitMQ
 
 import (
+	"context"
 	"fmt"
 	"github.com/aidenliu/goutil/config"
 	"github.com/streadway/amqp"
 	"log"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -22,21 +24,28 @@ const (
 type ConsumeResult struct {
 	error
 	Requeue bool
+	// Retry 按 ConsumeConfig.Retry 的退避策略重试，优先于 Requeue；
+	// 未配置 Retry 时 nack 不重新入队，队列配置了死信交换器时进入死信队列
+	Retry bool
 }
 
 type RabbitConfig struct {
 	ConfigKey string
 	DialStr   []string
+	// Dial 建立连接，默认 amqp.Dial
+	Dial DialFunc
 }
 
 type RabbitMQ struct {
-	connection  *amqp.Connection
-	channel     *amqp.Channel
+	connection  Connection
+	channel     Channel
+	dial        DialFunc
 	dialStr     string
 	connNotify  chan *amqp.Error
 	chNotify    chan *amqp.Error
 	done        chan struct{}
 	isConnected bool
+	delay       delayState
 }
 
 // ExchangeConfig 交换器配置
@@ -56,9 +65,13 @@ type QueueConfig struct {
 	RoutingKey string
 	Durable    bool
 	AutoDelete bool
-	exclusive  bool
+	Exclusive  bool
 	NoWait     bool
 	Args       map[string]interface{}
+	// Type 队列类型：classic、quorum、stream，对应 x-queue-type
+	Type string
+	// Lazy 惰性队列，对应 x-queue-mode=lazy
+	Lazy bool
 }
 
 // PublishConfig 生产者配置
@@ -67,6 +80,12 @@ type PublishConfig struct {
 	RoutingKey   string
 	Mandatory    bool
 	Immediate    bool
+	// ContentType 内容类型，Publish 默认 text/json
+	ContentType string
+	// MessageId 消息ID，泛型 Publish 未设置时自动生成
+	MessageId string
+	// SchemaVersion 消息结构版本，写入 x-schema-version 消息头
+	SchemaVersion string
 }
 
 // ConsumeConfig 消费者配置
@@ -77,12 +96,36 @@ type ConsumeConfig struct {
 	NoLocal      bool
 	NoWait       bool
 	Args         map[string]interface{}
+	Retry        *RetryConfig
+	// Middlewares 消费中间件，第一个在最外层
+	Middlewares []Middleware
+	// Workers 处理消息的协程数，大于 0 时与 AMQP 消费者数量分离，消息由协程池处理
+	Workers int
+	// PrefetchCount 每个消费者未确认消息数上限，默认 Workers，未启用协程池时为 1
+	PrefetchCount int
+	// PartitionKey 启用协程池时，相同 key 的消息由同一个协程按顺序处理；
+	// 设置后只启动一个 AMQP 消费者，忽略 consumerCount。
+	// 顺序只在消息首次投递时成立，重新入队（Requeue）或重试的消息会排在后续消息之后
+	PartitionKey func(d *amqp.Delivery) string
+}
+
+// Fail 消费失败，requeue 为 true 时重新入队
+func Fail(err error, requeue bool) ConsumeResult {
+	return ConsumeResult{error: err, Requeue: requeue}
+}
+
+// Retry 消费失败，按重试队列延迟重试
+func Retry(err error) ConsumeResult {
+	return ConsumeResult{error: err, Retry: true}
 }
 
 // New 创建RabbitMQ连接
 func New(rc *RabbitConfig) (*RabbitMQ, error) {
 	var err error
-	r := &RabbitMQ{}
+	r := &RabbitMQ{dial: rc.Dial, done: make(chan struct{})}
+	if r.dial == nil {
+		r.dial = dialAMQP
+	}
 	if rc.ConfigKey != "" {
 		configItem := config.Service(rc.ConfigKey)
 		if configItem == nil {
@@ -140,12 +183,13 @@ func (r *RabbitMQ) reconnect() {
 
 // connect 建立连接
 func (r *RabbitMQ) connect() (bool, error) {
-	conn, err := amqp.Dial(r.dialStr)
+	conn, err := r.dial(r.dialStr)
 	if err != nil {
 		return false, err
 	}
 	ch, err := conn.Channel()
 	if err != nil {
+		conn.Close()
 		return false, err
 	}
 	r.isConnected = true
@@ -159,6 +203,14 @@ func (r *RabbitMQ) connect() (bool, error) {
 	return true, nil
 }
 
+// openChannel 在当前连接上打开新的 channel
+func (r *RabbitMQ) openChannel() (Channel, error) {
+	if !r.isConnected || r.connection == nil {
+		return nil, fmt.Errorf("rabbitMQ not connected")
+	}
+	return r.connection.Channel()
+}
+
 // Close 关闭连接
 func (r *RabbitMQ) Close() {
 	if r.isConnected {
@@ -171,29 +223,56 @@ func (r *RabbitMQ) Close() {
 
 // Publish 发布消息
 func (r *RabbitMQ) Publish(playLoad []byte, p *PublishConfig) error {
-	err := r.channel.Publish(
-		p.ExChangeName,
-		p.RoutingKey,
-		p.Mandatory,
-		p.Immediate,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "text/json",
-			Body:         playLoad,
-		},
-	)
-	return err
+	contentType := p.ContentType
+	if contentType == "" {
+		contentType = "text/json"
+	}
+	msg := amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		ContentType:  contentType,
+		MessageId:    p.MessageId,
+		Body:         playLoad,
+	}
+	if p.SchemaVersion != "" {
+		msg.Headers = amqp.Table{schemaVersionHeader: p.SchemaVersion}
+	}
+	return r.publish(p.ExChangeName, p.RoutingKey, p.Mandatory, p.Immediate, msg)
+}
+
+// publish 发布消息
+func (r *RabbitMQ) publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	return r.channel.Publish(exchange, key, mandatory, immediate, msg)
 }
 
 // Consume 消费消息
 func (r *RabbitMQ) Consume(consumerCount int, callBack func([]byte) ConsumeResult, c *ConsumeConfig) error {
+	return r.ConsumeDelivery(consumerCount, func(ctx context.Context, d *amqp.Delivery) ConsumeResult {
+		return callBack(d.Body)
+	}, c)
+}
+
+// ConsumeDelivery 消费消息，回调可获取完整的消息属性
+func (r *RabbitMQ) ConsumeDelivery(consumerCount int, callBack DeliveryHandler, c *ConsumeConfig) error {
+	callBack = Chain(callBack, c.Middlewares...)
+	// 多个消费者并发分发会打乱同一分区内的顺序
+	if c.Workers > 0 && c.PartitionKey != nil && consumerCount > 1 {
+		log.Println("PartitionKey requires a single consumer, consumerCount reset to 1:", c.ConsumeQueue)
+		consumerCount = 1
+	}
+	prefetchCount := c.PrefetchCount
+	if prefetchCount <= 0 {
+		prefetchCount = 1
+		if c.Workers > 0 {
+			prefetchCount = c.Workers
+		}
+	}
 	for {
 		if !r.isConnected {
 			log.Println("connect retry....")
 			time.Sleep(connectWaitDelay)
 			continue
 		}
-		r.channel.Qos(1, 0, false)
+		r.channel.Qos(prefetchCount, 0, false)
 		deliveries := make([]<-chan amqp.Delivery, 0)
 		for n := 0; n < consumerCount; n++ {
 			if delivery, err := r.channel.Consume(
@@ -208,6 +287,34 @@ func (r *RabbitMQ) Consume(consumerCount int, callBack func([]byte) ConsumeResul
 				deliveries = append(deliveries, delivery)
 			}
 		}
+		// 订阅全部失败时 channel 通常已被关闭，等待重连
+		if len(deliveries) == 0 {
+			time.Sleep(connectWaitDelay)
+			continue
+		}
+		handle := func(d *amqp.Delivery) {
+			// 协程池中未捕获的 panic 会导致进程退出，始终捕获并 nack 不重新入队
+			defer func() {
+				if e := recover(); e != nil {
+					log.Printf("consume message[%s] panic:%v\n%s", d.MessageId, e, debug.Stack())
+					if !c.AutoAck {
+						if ackErr := d.Nack(false, false); ackErr != nil {
+							log.Println("ack err:", ackErr)
+						}
+					}
+				}
+			}()
+			consumeResult := callBack(context.Background(), d)
+			if c.AutoAck == false {
+				if ackErr := r.ack(d, consumeResult, c); ackErr != nil {
+					log.Println("ack err:", ackErr)
+				}
+			}
+		}
+		var pool *workerPool
+		if c.Workers > 0 {
+			pool = newWorkerPool(c.Workers, c.PartitionKey, handle)
+		}
 		var wg sync.WaitGroup
 		wg.Add(len(deliveries))
 		for _, delivery := range deliveries {
@@ -217,48 +324,64 @@ func (r *RabbitMQ) Consume(consumerCount int, callBack func([]byte) ConsumeResul
 					return
 				}
 				for d := range delivery {
-					consumeResult := callBack(d.Body)
-					if c.AutoAck == false {
-						var ackErr error
-						if consumeResult.error != nil {
-							log.Println("callBack err:", consumeResult.error)
-							switch consumeResult.Requeue {
-							case false:
-								ackErr = d.Nack(false, false)
-							case true:
-								ackErr = d.Nack(false, true)
-							default:
-								ackErr = d.Ack(false)
-							}
-						} else {
-							ackErr = d.Ack(false)
-						}
-						if ackErr != nil {
-							log.Println("ack err:", ackErr)
-						}
+					// 中间件（如 Timeout）可能在返回后继续使用 d，每条消息使用独立的变量
+					d := d
+					if pool != nil {
+						pool.dispatch(d)
+					} else {
+						handle(&d)
 					}
 				}
 				log.Println("delivery close...")
 			}(delivery)
 		}
 		wg.Wait()
+		if pool != nil {
+			pool.close()
+		}
 	}
-	return nil
 }
 
-// InitQueue 创建exchange、queue 绑定队列到exchange
+// ack 根据消费结果确认消息
+func (r *RabbitMQ) ack(d *amqp.Delivery, consumeResult ConsumeResult, c *ConsumeConfig) error {
+	if consumeResult.error == nil {
+		return d.Ack(false)
+	}
+	log.Println("callBack err:", consumeResult.error)
+	if consumeResult.Retry {
+		if c.Retry == nil {
+			// 重新入队会使无法处理的消息无限循环，交由死信交换器处理
+			log.Println("retry requested but ConsumeConfig.Retry is nil, nack to dead letter:", c.ConsumeQueue)
+			return d.Nack(false, false)
+		}
+		// 重试消息投递失败时重新入队，避免丢失
+		if err := r.retry(d, c.Retry, consumeResult.error); err != nil {
+			log.Println("retry err:", err)
+			return d.Nack(false, true)
+		}
+		return d.Ack(false)
+	}
+	return d.Nack(false, consumeResult.Requeue)
+}
+
+// InitQueue 创建exchange、queue 绑定队列到exchange，每一步失败都会记录日志并继续执行，返回第一个错误
 func (r *RabbitMQ) InitQueue(ex *ExchangeConfig, q *QueueConfig) (queue amqp.Queue, err error) {
-	err = r.exchangeDeclare(ex)
-	if err != nil {
-		log.Println("exchangeDeclare error:", err, ex)
+	if exErr := r.exchangeDeclare(ex); exErr != nil {
+		log.Println("exchangeDeclare error:", exErr, ex)
+		err = exErr
 	}
-	queue, err = r.queueDeclare(q)
-	if err != nil {
-		log.Println("queueDeclare error:", err, q)
+	queue, qErr := r.queueDeclare(q)
+	if qErr != nil {
+		log.Println("queueDeclare error:", qErr, q)
+		if err == nil {
+			err = qErr
+		}
 	}
-	err = r.queueBind(ex, q)
-	if err != nil {
-		log.Println("queueBind error:", err, ex, q)
+	if bindErr := r.queueBind(ex, q); bindErr != nil {
+		log.Println("queueBind error:", bindErr, ex, q)
+		if err == nil {
+			err = bindErr
+		}
 	}
 	return
 }
@@ -272,7 +395,7 @@ func (r *RabbitMQ) exchangeDeclare(ex *ExchangeConfig) error {
 		ex.AutoDelete,
 		ex.Internal,
 		ex.NoWait,
-		ex.Args,
+		amqpTable(ex.Args),
 	)
 	return err
 }
@@ -283,9 +406,9 @@ func (r *RabbitMQ) queueDeclare(q *QueueConfig) (amqp.Queue, error) {
 		q.Name,
 		q.Durable,
 		q.AutoDelete,
-		q.exclusive,
+		q.Exclusive,
 		q.NoWait,
-		q.Args,
+		q.args(),
 	)
 	return queue, err
 }
@@ -297,3 +420,18 @@ func (r *RabbitMQ) queueBind(ex *ExchangeConfig, q *QueueConfig) error {
 	exchangeName := ex.Name
 	return r.channel.QueueBind(queueName, routingKey, exchangeName, false, nil)
 }
+
+// args 队列参数，合并 Type、Lazy 配置
+func (q *QueueConfig) args() amqp.Table {
+	args := amqpTable(q.Args)
+	if args == nil {
+		args = amqp.Table{}
+	}
+	if q.Type != "" {
+		args["x-queue-type"] = q.Type
+	}
+	if q.Lazy {
+		args["x-queue-mode"] = "lazy"
+	}
+	return args
+}
@@ -0,0 +1,64 @@
+package rabbitMQ_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"github.com/aidenliu/goutil/rabbitMQ/mqtest"
+)
+
+// 等待异步处理完成的超时时间
+const waitTimeout = 2 * time.Second
+
+// newMQ 创建连接到内存代理的客户端
+func newMQ(t *testing.T) (*mqtest.Broker, *rabbitMQ.RabbitMQ) {
+	t.Helper()
+	broker := mqtest.New()
+	mq, err := rabbitMQ.New(&rabbitMQ.RabbitConfig{DialStr: []string{"amqp://mqtest"}, Dial: broker.Dial})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return broker, mq
+}
+
+// declareQueue 在默认交换器上声明队列
+func declareQueue(t *testing.T, mq *rabbitMQ.RabbitMQ, name string, args map[string]interface{}) {
+	t.Helper()
+	err := mq.DeclareTopology(&rabbitMQ.Topology{Queues: []rabbitMQ.QueueConfig{{Name: name, Durable: true, Args: args}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor 等待 cond 成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRetryWithoutConfigDeadLetters(t *testing.T) {
+	broker, mq := newMQ(t)
+	declareQueue(t, mq, "jobs", map[string]interface{}{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "jobs.dead"})
+	declareQueue(t, mq, "jobs.dead", nil)
+	calls := make(chan struct{}, 10)
+	go mq.Consume(1, func(body []byte) rabbitMQ.ConsumeResult {
+		calls <- struct{}{}
+		return rabbitMQ.Retry(errors.New("boom"))
+	}, &rabbitMQ.ConsumeConfig{ConsumeQueue: "jobs"})
+	if err := mq.Publish([]byte("{}"), &rabbitMQ.PublishConfig{RoutingKey: "jobs"}); err != nil {
+		t.Fatal(err)
+	}
+	// 未配置重试队列时不重新入队，进入死信队列
+	waitFor(t, "dead letter", func() bool { return broker.QueueLen("jobs.dead") == 1 })
+	if n := len(calls); n != 1 {
+		t.Fatalf("handler called %d times, want 1", n)
+	}
+}
@@ -0,0 +1,153 @@
+package rabbitMQ
+
+import (
+	"fmt"
+	"github.com/streadway/amqp"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// 重试次数消息头，x-death 被代理清理时作为兜底计数
+	retryCountHeader = "x-retry-count"
+	// 最后一次失败原因消息头
+	retryErrorHeader = "x-retry-error"
+)
+
+// RetryConfig 重试队列配置
+// 每个退避时间对应一个延迟队列：<Queue>.retry.<毫秒>，消息在延迟队列过期后通过死信回到 Queue，
+// 重试次数达到 MaxAttempts 后投递到 ParkingLot 队列
+type RetryConfig struct {
+	Queue       string
+	Backoff     []time.Duration
+	MaxAttempts int
+	ParkingLot  string
+}
+
+// retryExchange 重试交换器名称
+func (rc *RetryConfig) retryExchange() string {
+	return rc.Queue + ".retry"
+}
+
+// parkingLot 超过最大重试次数后的队列名称
+func (rc *RetryConfig) parkingLot() string {
+	if rc.ParkingLot != "" {
+		return rc.ParkingLot
+	}
+	return rc.Queue + ".parking"
+}
+
+// maxAttempts 最大重试次数，未配置时为退避时间个数
+func (rc *RetryConfig) maxAttempts() int {
+	if rc.MaxAttempts > 0 {
+		return rc.MaxAttempts
+	}
+	return len(rc.Backoff)
+}
+
+// delayQueue 第 attempt 次重试使用的延迟队列，超出退避表长度时使用最后一个
+func (rc *RetryConfig) delayQueue(attempt int) (string, time.Duration) {
+	if attempt >= len(rc.Backoff) {
+		attempt = len(rc.Backoff) - 1
+	}
+	delay := rc.Backoff[attempt]
+	return fmt.Sprintf("%s.%d", rc.retryExchange(), delay.Milliseconds()), delay
+}
+
+// DeclareRetry 创建重试交换器、延迟队列和 parking lot 队列
+func (r *RabbitMQ) DeclareRetry(rc *RetryConfig) error {
+	if rc.Queue == "" {
+		return fmt.Errorf("rabbitMQ retry queue is empty")
+	}
+	if len(rc.Backoff) == 0 {
+		return fmt.Errorf("rabbitMQ retry backoff of %s is empty", rc.Queue)
+	}
+	ex := &ExchangeConfig{Name: rc.retryExchange(), Type: amqp.ExchangeDirect, Durable: true}
+	if err := r.exchangeDeclare(ex); err != nil {
+		return err
+	}
+	for i := range rc.Backoff {
+		name, delay := rc.delayQueue(i)
+		q := &QueueConfig{
+			Name:       name,
+			RoutingKey: name,
+			Durable:    true,
+			Args: amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": rc.Queue,
+			},
+		}
+		if _, err := r.queueDeclare(q); err != nil {
+			return err
+		}
+		if err := r.queueBind(ex, q); err != nil {
+			return err
+		}
+	}
+	_, err := r.queueDeclare(&QueueConfig{Name: rc.parkingLot(), Durable: true})
+	return err
+}
+
+// RetryAttempts 消息已重试次数
+func RetryAttempts(d *amqp.Delivery, rc *RetryConfig) int {
+	var attempts int
+	if deaths, ok := d.Headers["x-death"].([]interface{}); ok {
+		prefix := rc.retryExchange() + "."
+		for _, v := range deaths {
+			death, ok := v.(amqp.Table)
+			if !ok {
+				continue
+			}
+			if queue, _ := death["queue"].(string); strings.HasPrefix(queue, prefix) {
+				count, _ := death["count"].(int64)
+				attempts += int(count)
+			}
+		}
+	}
+	var count int
+	switch v := d.Headers[retryCountHeader].(type) {
+	case int32:
+		count = int(v)
+	case int64:
+		count = int(v)
+	}
+	if count > attempts {
+		attempts = count
+	}
+	return attempts
+}
+
+// retry 按退避策略投递到延迟队列，超过最大重试次数投递到 parking lot
+func (r *RabbitMQ) retry(d *amqp.Delivery, rc *RetryConfig, cause error) error {
+	attempts := RetryAttempts(d, rc)
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[retryCountHeader] = int32(attempts + 1)
+	if cause != nil {
+		headers[retryErrorHeader] = cause.Error()
+	}
+	msg := amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+	if attempts >= rc.maxAttempts() {
+		log.Printf("message exceeded %d retries, park to %s\n", rc.maxAttempts(), rc.parkingLot())
+		return r.publish("", rc.parkingLot(), false, false, msg)
+	}
+	queue, _ := rc.delayQueue(attempts)
+	return r.publish(rc.retryExchange(), queue, false, false, msg)
+}
@@ -0,0 +1,45 @@
+package rabbitMQ_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"github.com/streadway/amqp"
+)
+
+func TestRetryParksAfterMaxAttempts(t *testing.T) {
+	broker, mq := newMQ(t)
+	rc := &rabbitMQ.RetryConfig{Queue: "jobs", Backoff: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}}
+	declareQueue(t, mq, "jobs", nil)
+	if err := mq.DeclareRetry(rc); err != nil {
+		t.Fatal(err)
+	}
+	attempts := make(chan int, 10)
+	go mq.ConsumeDelivery(1, func(ctx context.Context, d *amqp.Delivery) rabbitMQ.ConsumeResult {
+		attempts <- rabbitMQ.RetryAttempts(d, rc)
+		return rabbitMQ.Retry(errors.New("boom"))
+	}, &rabbitMQ.ConsumeConfig{ConsumeQueue: "jobs", Retry: rc})
+	if err := mq.Publish([]byte("{}"), &rabbitMQ.PublishConfig{RoutingKey: "jobs", MessageId: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "parking lot", func() bool { return broker.QueueLen("jobs.parking") == 1 })
+	// 首次投递加上每个退避时间各重试一次
+	for want := 0; want <= len(rc.Backoff); want++ {
+		if got := <-attempts; got != want {
+			t.Fatalf("delivery %d retry attempts = %d, want %d", want, got, want)
+		}
+	}
+	if n := len(attempts); n != 0 {
+		t.Fatalf("handler called %d extra times", n)
+	}
+	parked := broker.Messages("jobs.parking")[0]
+	if parked.MessageId != "m1" || parked.Headers["x-retry-error"] != "boom" {
+		t.Fatalf("parked message = %s %v, want m1 with retry error", parked.MessageId, parked.Headers)
+	}
+	if got := broker.QueueLen("jobs"); got != 0 {
+		t.Fatalf("jobs len = %d, want 0", got)
+	}
+}
@@ -0,0 +1,237 @@
+package rabbitMQ
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// RabbitMQ direct reply-to 伪队列
+	replyToQueue = "amq.rabbitmq.reply-to"
+	// RPC 错误消息头
+	rpcErrorHeader = "x-rpc-error"
+	// 未设置 deadline 时的默认调用超时
+	rpcDefaultTimeout = 10 * time.Second
+)
+
+// ErrRpcClosed RPC 客户端 channel 已关闭
+var ErrRpcClosed = errors.New("rabbitMQ rpc channel closed")
+
+// RpcError 服务端处理失败返回的错误
+type RpcError struct {
+	Method  string
+	Message string
+}
+
+func (e *RpcError) Error() string {
+	return fmt.Sprintf("rabbitMQ rpc %s: %s", e.Method, e.Message)
+}
+
+// RpcHandler RPC 服务端处理函数
+type RpcHandler func(ctx context.Context, body []byte) ([]byte, error)
+
+// RpcClient 基于 direct reply-to 的 RPC 客户端，支持并发调用
+type RpcClient struct {
+	r       *RabbitMQ
+	mu      sync.Mutex
+	channel Channel
+	pending map[string]chan amqp.Delivery
+}
+
+// NewRpcClient 创建 RPC 客户端
+func NewRpcClient(r *RabbitMQ) *RpcClient {
+	return &RpcClient{r: r, pending: make(map[string]chan amqp.Delivery)}
+}
+
+// open 打开专用 channel 并订阅 reply-to，channel 关闭后下次调用重新打开
+func (c *RpcClient) open() (Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.channel != nil {
+		return c.channel, nil
+	}
+	ch, err := c.r.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	// direct reply-to 必须以 no-ack 模式在发布请求的同一个 channel 上消费
+	replies, err := ch.Consume(replyToQueue, "", true, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	c.channel = ch
+	go c.dispatch(ch, replies)
+	return ch, nil
+}
+
+// dispatch 按 correlation id 分发响应
+func (c *RpcClient) dispatch(ch Channel, replies <-chan amqp.Delivery) {
+	for d := range replies {
+		c.mu.Lock()
+		reply, ok := c.pending[d.CorrelationId]
+		delete(c.pending, d.CorrelationId)
+		c.mu.Unlock()
+		if ok {
+			reply <- d
+		}
+	}
+	// channel 关闭，通知所有等待中的调用
+	c.mu.Lock()
+	if c.channel == ch {
+		c.channel = nil
+	}
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
+
+// Call 调用 queue 上的 method，ctx 未设置 deadline 时默认超时 10 秒
+func (c *RpcClient) Call(ctx context.Context, queue, method string, body []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rpcDefaultTimeout)
+		defer cancel()
+	}
+	ch, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	correlationId, err := newId()
+	if err != nil {
+		return nil, err
+	}
+	reply := make(chan amqp.Delivery, 1)
+	c.mu.Lock()
+	c.pending[correlationId] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, correlationId)
+		c.mu.Unlock()
+	}()
+
+	deadline, _ := ctx.Deadline()
+	msg := amqp.Publishing{
+		ContentType:   "text/json",
+		CorrelationId: correlationId,
+		ReplyTo:       replyToQueue,
+		Type:          method,
+		Timestamp:     time.Now(),
+		Body:          body,
+	}
+	// 调用方超时后请求不再有意义，由代理丢弃
+	if ttl := time.Until(deadline).Milliseconds(); ttl > 0 {
+		msg.Expiration = strconv.FormatInt(ttl, 10)
+	}
+	if err = ch.Publish("", queue, false, false, msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case d, ok := <-reply:
+		if !ok {
+			return nil, ErrRpcClosed
+		}
+		if errMsg, ok := d.Headers[rpcErrorHeader].(string); ok {
+			return nil, &RpcError{Method: method, Message: errMsg}
+		}
+		return d.Body, nil
+	}
+}
+
+// Close 关闭 RPC 客户端
+func (c *RpcClient) Close() error {
+	c.mu.Lock()
+	ch := c.channel
+	c.channel = nil
+	c.mu.Unlock()
+	if ch == nil {
+		return nil
+	}
+	return ch.Close()
+}
+
+// newId 生成随机ID，用作 correlation id、message id
+func newId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RpcServer RPC 服务端，按方法名注册处理函数
+type RpcServer struct {
+	r        *RabbitMQ
+	mu       sync.RWMutex
+	handlers map[string]RpcHandler
+}
+
+// NewRpcServer 创建 RPC 服务端
+func NewRpcServer(r *RabbitMQ) *RpcServer {
+	return &RpcServer{r: r, handlers: make(map[string]RpcHandler)}
+}
+
+// Handle 注册方法处理函数
+func (s *RpcServer) Handle(method string, h RpcHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// Serve 消费 queue 上的请求并回复，queue 需事先创建
+func (s *RpcServer) Serve(consumerCount int, queue string) error {
+	return s.r.ConsumeDelivery(consumerCount, s.serve, &ConsumeConfig{ConsumeQueue: queue})
+}
+
+// serve 处理单个请求
+func (s *RpcServer) serve(ctx context.Context, d *amqp.Delivery) ConsumeResult {
+	s.mu.RLock()
+	h, ok := s.handlers[d.Type]
+	s.mu.RUnlock()
+
+	var body []byte
+	var err error
+	if ok {
+		if d.Expiration != "" {
+			if ttl, e := strconv.ParseInt(d.Expiration, 10, 64); e == nil {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Duration(ttl)*time.Millisecond)
+				defer cancel()
+			}
+		}
+		body, err = h(ctx, d.Body)
+	} else {
+		err = fmt.Errorf("method %s not found", d.Type)
+	}
+	if d.ReplyTo == "" {
+		return ConsumeResult{error: err}
+	}
+	msg := amqp.Publishing{
+		ContentType:   "text/json",
+		CorrelationId: d.CorrelationId,
+		Timestamp:     time.Now(),
+		Body:          body,
+	}
+	if err != nil {
+		msg.Headers = amqp.Table{rpcErrorHeader: err.Error()}
+	}
+	if pubErr := s.r.publish("", d.ReplyTo, false, false, msg); pubErr != nil {
+		log.Println("rpc reply err:", pubErr)
+	}
+	// 错误已回复给调用方，请求本身不再重新入队
+	return ConsumeResult{}
+}
@@ -0,0 +1,76 @@
+package rabbitMQ_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+)
+
+func TestRpcRoundTrip(t *testing.T) {
+	_, mq := newMQ(t)
+	declareQueue(t, mq, "rpc", nil)
+	server := rabbitMQ.NewRpcServer(mq)
+	server.Handle("echo", func(ctx context.Context, body []byte) ([]byte, error) {
+		return body, nil
+	})
+	server.Handle("fail", func(ctx context.Context, body []byte) ([]byte, error) {
+		return nil, errors.New("bad request")
+	})
+	go server.Serve(2, "rpc")
+
+	client := rabbitMQ.NewRpcClient(mq)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	// 并发调用按 correlation id 返回各自的响应
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			want := fmt.Sprintf("ping-%d", i)
+			reply, err := client.Call(ctx, "rpc", "echo", []byte(want))
+			if err == nil && string(reply) != want {
+				err = fmt.Errorf("reply = %s, want %s", reply, want)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := client.Call(ctx, "rpc", "fail", nil)
+	var rpcErr *rabbitMQ.RpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Method != "fail" || rpcErr.Message != "bad request" {
+		t.Fatalf("fail call err = %v, want RpcError bad request", err)
+	}
+	_, err = client.Call(ctx, "rpc", "missing", nil)
+	if !errors.As(err, &rpcErr) || rpcErr.Method != "missing" {
+		t.Fatalf("missing method err = %v, want RpcError", err)
+	}
+}
+
+func TestRpcCallTimeout(t *testing.T) {
+	_, mq := newMQ(t)
+	// 没有服务端消费请求
+	declareQueue(t, mq, "rpc", nil)
+	client := rabbitMQ.NewRpcClient(mq)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Call(ctx, "rpc", "echo", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("call err = %v, want deadline exceeded", err)
+	}
+}
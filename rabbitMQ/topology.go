@@ -0,0 +1,190 @@
+package rabbitMQ
+
+import (
+	"fmt"
+	"github.com/aidenliu/goutil/config"
+	"github.com/streadway/amqp"
+	"strings"
+)
+
+// 绑定目标类型
+const (
+	BindQueue    = "queue"
+	BindExchange = "exchange"
+)
+
+// Topology 交换器、队列及绑定关系定义，可在 service.yaml 中配置：
+//
+//	order_topology:
+//	  exchanges:
+//	    - {name: order, type: topic, durable: true}
+//	  queues:
+//	    - {name: order.created, durable: true, type: quorum}
+//	  bindings:
+//	    - {source: order, destination: order.created, routingkeys: [order.created, order.paid]}
+type Topology struct {
+	Exchanges []ExchangeConfig
+	Queues    []QueueConfig
+	Bindings  []BindingConfig
+}
+
+// BindingConfig 绑定定义
+type BindingConfig struct {
+	// Source 源交换器
+	Source string
+	// Destination 目标队列或交换器
+	Destination string
+	// DestinationType 目标类型：queue（默认）、exchange
+	DestinationType string
+	// RoutingKeys 路由键，每个路由键一个绑定，为空时使用空路由键
+	RoutingKeys []string
+	// Headers headers 交换器的匹配参数，包含 x-match: all/any
+	Headers map[string]interface{}
+	NoWait  bool
+}
+
+// TopologyError 拓扑声明过程中的全部错误
+type TopologyError struct {
+	Errors []error
+}
+
+func (e *TopologyError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("rabbitMQ declare topology %d errors: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// DeclareTopologyFromConfig 读取 service.yaml 中 configKey 对应的拓扑并声明
+func (r *RabbitMQ) DeclareTopologyFromConfig(configKey string) error {
+	var t Topology
+	if err := config.ServiceDecode(configKey, &t); err != nil {
+		return err
+	}
+	return r.DeclareTopology(&t)
+}
+
+// DeclareTopology 依次声明交换器、队列、绑定，已存在且参数一致的定义不受影响。
+// 声明失败会导致 channel 被关闭，因此使用独立的 channel 并在失败后重新打开，
+// 保证所有定义都会被尝试，返回的 *TopologyError 包含每一个失败项
+func (r *RabbitMQ) DeclareTopology(t *Topology) error {
+	d := &topologyDeclarer{r: r}
+	defer d.close()
+	for i := range t.Exchanges {
+		ex := &t.Exchanges[i]
+		d.do(fmt.Sprintf("exchange %s", ex.Name), func(ch Channel) error {
+			return ch.ExchangeDeclare(ex.Name, ex.Type, ex.Durable, ex.AutoDelete, ex.Internal, ex.NoWait, amqpTable(ex.Args))
+		})
+	}
+	for i := range t.Queues {
+		q := &t.Queues[i]
+		d.do(fmt.Sprintf("queue %s", q.Name), func(ch Channel) error {
+			_, err := ch.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, q.NoWait, q.args())
+			return err
+		})
+	}
+	for i := range t.Bindings {
+		b := &t.Bindings[i]
+		routingKeys := b.RoutingKeys
+		if len(routingKeys) == 0 {
+			routingKeys = []string{""}
+		}
+		for _, key := range routingKeys {
+			key := key
+			d.do(fmt.Sprintf("binding %s -> %s(%s)", b.Source, b.Destination, key), func(ch Channel) error {
+				if b.DestinationType == BindExchange {
+					return ch.ExchangeBind(b.Destination, key, b.Source, b.NoWait, amqpTable(b.Headers))
+				}
+				return ch.QueueBind(b.Destination, key, b.Source, b.NoWait, amqpTable(b.Headers))
+			})
+		}
+	}
+	if len(d.errs) > 0 {
+		return &TopologyError{Errors: d.errs}
+	}
+	return nil
+}
+
+// topologyDeclarer 使用独立 channel 执行声明并收集错误
+type topologyDeclarer struct {
+	r    *RabbitMQ
+	ch   Channel
+	errs []error
+}
+
+// do 执行一次声明，失败后丢弃 channel，下次声明重新打开
+func (d *topologyDeclarer) do(name string, declare func(ch Channel) error) {
+	if d.ch == nil {
+		ch, err := d.r.openChannel()
+		if err != nil {
+			d.errs = append(d.errs, fmt.Errorf("%s: %w", name, err))
+			return
+		}
+		d.ch = ch
+	}
+	if err := declare(d.ch); err != nil {
+		d.errs = append(d.errs, fmt.Errorf("%s: %w", name, err))
+		d.close()
+	}
+}
+
+// close 关闭 channel
+func (d *topologyDeclarer) close() {
+	if d.ch != nil {
+		d.ch.Close()
+		d.ch = nil
+	}
+}
+
+// amqpTable 将配置解析得到的参数转换为 amqp.Table，
+// AMQP 不支持 int、uint 及非 Table 的嵌套 map，需转换为 int64 和 amqp.Table
+func amqpTable(m map[string]interface{}) amqp.Table {
+	if m == nil {
+		return nil
+	}
+	t := make(amqp.Table, len(m))
+	for k, v := range m {
+		t[k] = amqpValue(v)
+	}
+	return t
+}
+
+// amqpValue 转换单个参数值
+func amqpValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint16:
+		return int32(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case amqp.Table:
+		return amqpTable(v)
+	case map[string]interface{}:
+		return amqpTable(v)
+	case map[interface{}]interface{}:
+		t := make(amqp.Table, len(v))
+		for k, item := range v {
+			t[fmt.Sprint(k)] = amqpValue(item)
+		}
+		return t
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = amqpValue(item)
+		}
+		return list
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = item
+		}
+		return list
+	}
+	return v
+}
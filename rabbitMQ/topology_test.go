@@ -0,0 +1,90 @@
+package rabbitMQ_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aidenliu/goutil/rabbitMQ"
+	"github.com/streadway/amqp"
+)
+
+func TestDeclareTopology(t *testing.T) {
+	broker, mq := newMQ(t)
+	topology := &rabbitMQ.Topology{
+		Exchanges: []rabbitMQ.ExchangeConfig{
+			{Name: "events", Type: amqp.ExchangeTopic, Durable: true},
+			{Name: "audit", Type: amqp.ExchangeFanout, Durable: true},
+			{Name: "vip", Type: amqp.ExchangeHeaders, Durable: true},
+		},
+		Queues: []rabbitMQ.QueueConfig{
+			{Name: "orders", Durable: true, Type: "quorum"},
+			{Name: "audit.log", Durable: true, Lazy: true},
+		},
+		Bindings: []rabbitMQ.BindingConfig{
+			{Source: "events", Destination: "orders", RoutingKeys: []string{"order.created", "order.paid"}},
+			{Source: "events", Destination: "audit", DestinationType: rabbitMQ.BindExchange, RoutingKeys: []string{"#"}},
+			{Source: "audit", Destination: "audit.log"},
+			// 配置解析得到的 int 需转换为 AMQP 支持的类型
+			{Source: "vip", Destination: "orders", Headers: map[string]interface{}{"x-match": "all", "level": 1}},
+		},
+	}
+	// 重复声明相同的拓扑不报错
+	for i := 0; i < 2; i++ {
+		if err := mq.DeclareTopology(topology); err != nil {
+			t.Fatalf("declare %d: %v", i, err)
+		}
+	}
+	for _, key := range []string{"order.created", "order.paid", "order.deleted"} {
+		if err := mq.Publish([]byte("{}"), &rabbitMQ.PublishConfig{ExChangeName: "events", RoutingKey: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 发布带自定义消息头的消息需要直接使用 channel
+	conn, err := broker.Dial("amqp://mqtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range []int64{1, 2} {
+		if err = ch.Publish("vip", "", false, false, amqp.Publishing{Headers: amqp.Table{"level": level}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]int{"orders": 3, "audit.log": 3}
+	for queue, n := range want {
+		if got := broker.QueueLen(queue); got != n {
+			t.Errorf("queue %s len = %d, want %d", queue, got, n)
+		}
+	}
+}
+
+func TestDeclareTopologyReportsEveryError(t *testing.T) {
+	broker, mq := newMQ(t)
+	declareQueue(t, mq, "orders", nil)
+	err := mq.DeclareTopology(&rabbitMQ.Topology{
+		Queues: []rabbitMQ.QueueConfig{
+			// 与已存在的队列参数不一致
+			{Name: "orders", Durable: false},
+			{Name: "payments", Durable: true},
+		},
+		Bindings: []rabbitMQ.BindingConfig{
+			{Source: "missing", Destination: "payments", RoutingKeys: []string{"a", "b"}},
+		},
+	})
+	var topologyErr *rabbitMQ.TopologyError
+	if !errors.As(err, &topologyErr) {
+		t.Fatalf("err = %v, want TopologyError", err)
+	}
+	// 每个路由键一个绑定，各自失败
+	if n := len(topologyErr.Errors); n != 3 {
+		t.Fatalf("errors = %v, want 3", topologyErr.Errors)
+	}
+	// 失败后重新打开 channel，后续定义仍被声明
+	if !broker.HasQueue("payments") {
+		t.Fatal("queue payments not declared after failure")
+	}
+}
@@ -0,0 +1,72 @@
+package rand
+
+import (
+	crand "crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+// Bytes 生成 n 个密码学安全的随机字节，n <= 0 时返回空 slice
+func Bytes(n int) ([]byte, error) {
+	if n <= 0 {
+		return []byte{}, nil
+	}
+	b := make([]byte, n)
+	if _, err := crand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Token 生成 n 字节的安全随机令牌，hex 编码，长度为 2n
+func Token(n int) (string, error) {
+	b, err := Bytes(n)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// TokenURLSafe 生成 n 字节的安全随机令牌，URL 安全的 base64 编码（无填充）
+func TokenURLSafe(n int) (string, error) {
+	b, err := Bytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CryptoInt 生成 [0, n) 的安全随机数
+func CryptoInt(n int64) (int64, error) {
+	if n <= 0 {
+		return 0, errors.New("rand: invalid argument to CryptoInt")
+	}
+	v, err := crand.Int(crand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0, err
+	}
+	return v.Int64(), nil
+}
+
+// CryptoString 从 alphabet 中安全地随机选取 n 个字符，用于验证码、邀请码等，
+// alphabet 为空时使用 Alphanumeric，n <= 0 时返回空字符串
+func CryptoString(n int, alphabet string) (string, error) {
+	if n <= 0 {
+		return "", nil
+	}
+	if alphabet == "" {
+		alphabet = Alphanumeric
+	}
+	chars := []rune(alphabet)
+	out := make([]rune, n)
+	for i := range out {
+		idx, err := CryptoInt(int64(len(chars)))
+		if err != nil {
+			return "", err
+		}
+		out[i] = chars[idx]
+	}
+	return string(out), nil
+}
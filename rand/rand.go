@@ -0,0 +1,184 @@
+package rand
+
+import (
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+// 常用字符集
+const (
+	Digits       = "0123456789"
+	LowerLetters = "abcdefghijklmnopqrstuvwxyz"
+	UpperLetters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	Letters      = LowerLetters + UpperLetters
+	Alphanumeric = Digits + Letters
+	HexDigits    = "0123456789abcdef"
+	// Readable 去掉易混淆的 0/O、1/l/I
+	Readable = "23456789abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+// Rand 并发安全的伪随机数生成器，不可用于安全场景，安全场景使用 Token、CryptoString
+type Rand struct {
+	mu sync.Mutex
+	r  *mrand.Rand
+}
+
+// New 创建生成器，相同 seed 生成相同的序列，便于测试复现
+func New(seed int64) *Rand {
+	return &Rand{r: mrand.New(mrand.NewSource(seed))}
+}
+
+// std 包级函数使用的生成器，只在初始化时播种一次
+var std = New(time.Now().UnixNano())
+
+// Int63 非负 int64
+func (r *Rand) Int63() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Int63()
+}
+
+// Int63n [0, n) 的 int64，n <= 0 时 panic
+func (r *Rand) Int63n(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Int63n(n)
+}
+
+// Intn [0, n) 的 int，n <= 0 时 panic
+func (r *Rand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Intn(n)
+}
+
+// Float64 [0.0, 1.0) 的浮点数
+func (r *Rand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Float64()
+}
+
+// RandRange [min, max] 的整数，min 大于 max 时交换
+func (r *Rand) RandRange(min, max int) int {
+	if min > max {
+		min, max = max, min
+	}
+	span := int64(max) - int64(min) + 1
+	if span <= 0 {
+		// 跨度超出 int64，在整个 int64 范围内拒绝采样
+		for {
+			r.mu.Lock()
+			v := int(r.r.Uint64())
+			r.mu.Unlock()
+			if v >= min && v <= max {
+				return v
+			}
+		}
+	}
+	return min + int(r.Int63n(span))
+}
+
+// RandString 从 alphabet 中随机选取 n 个字符，alphabet 为空时使用 Alphanumeric，n <= 0 时返回空字符串
+func (r *Rand) RandString(n int, alphabet string) string {
+	if n <= 0 {
+		return ""
+	}
+	if alphabet == "" {
+		alphabet = Alphanumeric
+	}
+	chars := []rune(alphabet)
+	out := make([]rune, n)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range out {
+		out[i] = chars[r.r.Intn(len(chars))]
+	}
+	return string(out)
+}
+
+// Shuffle 随机打乱 n 个元素，swap 交换 i、j 位置的元素；
+// 调用 swap 时不持有锁，swap 中可以继续使用该生成器
+func (r *Rand) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, r.Intn(i+1))
+	}
+}
+
+// WeightedIndex 按权重随机选择下标，权重为负数时视为 0，权重之和不大于 0 时返回 -1
+func (r *Rand) WeightedIndex(weights []float64) int {
+	var total float64
+	for _, w := range weights {
+		if w > 0 {
+			total += w
+		}
+	}
+	if total <= 0 {
+		return -1
+	}
+	target := r.Float64() * total
+	last := -1
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		last = i
+		if target < w {
+			return i
+		}
+		target -= w
+	}
+	// 浮点误差时落在最后一个有效权重上
+	return last
+}
+
+// Intn 使用默认生成器生成 [0, n) 的 int
+func Intn(n int) int {
+	return std.Intn(n)
+}
+
+// Float64 使用默认生成器生成 [0.0, 1.0) 的浮点数
+func Float64() float64 {
+	return std.Float64()
+}
+
+// RandRange 使用默认生成器生成 [min, max] 的整数
+func RandRange(min, max int) int {
+	return std.RandRange(min, max)
+}
+
+// RandString 使用默认生成器从 alphabet 中随机选取 n 个字符，n <= 0 时返回空字符串
+func RandString(n int, alphabet string) string {
+	return std.RandString(n, alphabet)
+}
+
+// Shuffle 使用默认生成器原地打乱 slice
+func Shuffle[T any](s []T) {
+	ShuffleWith(std, s)
+}
+
+// ShuffleWith 使用指定生成器原地打乱 slice
+func ShuffleWith[T any](r *Rand, s []T) {
+	r.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+}
+
+// WeightedChoice 按权重随机选择一个元素，items 与 weights 一一对应；
+// 没有可选元素时 ok 为 false
+//
+//	prize, _ := rand.WeightedChoice([]string{"a", "b", "c"}, []float64{70, 25, 5})
+func WeightedChoice[T any](items []T, weights []float64) (item T, ok bool) {
+	return WeightedChoiceWith(std, items, weights)
+}
+
+// WeightedChoiceWith 使用指定生成器按权重随机选择一个元素
+func WeightedChoiceWith[T any](r *Rand, items []T, weights []float64) (item T, ok bool) {
+	if len(weights) > len(items) {
+		weights = weights[:len(items)]
+	}
+	i := r.WeightedIndex(weights)
+	if i < 0 {
+		return item, false
+	}
+	return items[i], true
+}
@@ -0,0 +1,124 @@
+package rand
+
+import (
+	"math"
+	mrand "math/rand"
+	"testing"
+)
+
+func TestRandRangeBounds(t *testing.T) {
+	r := New(1)
+	tests := []struct {
+		min, max int
+	}{
+		{0, 0},
+		{5, 5},
+		{-3, 3},
+		{10, 1},
+		{math.MaxInt - 1, math.MaxInt},
+		{math.MinInt, math.MinInt + 1},
+		{math.MinInt, math.MaxInt},
+		{-1, math.MaxInt},
+	}
+	for _, tt := range tests {
+		lo, hi := tt.min, tt.max
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		for i := 0; i < 1000; i++ {
+			if v := r.RandRange(tt.min, tt.max); v < lo || v > hi {
+				t.Fatalf("RandRange(%d, %d) = %d, out of range", tt.min, tt.max, v)
+			}
+		}
+	}
+}
+
+func TestRandRangeCoversBothEnds(t *testing.T) {
+	r := New(1)
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		seen[r.RandRange(3, -2)] = true
+	}
+	for v := -2; v <= 3; v++ {
+		if !seen[v] {
+			t.Fatalf("RandRange(3, -2) never returned %d", v)
+		}
+	}
+}
+
+func TestSeededSequence(t *testing.T) {
+	// 相同 seed 与 math/rand 的序列一致，可在测试中复现
+	want := mrand.New(mrand.NewSource(42))
+	r := New(42)
+	for i := 0; i < 20; i++ {
+		if got, w := r.Intn(100), want.Intn(100); got != w {
+			t.Fatalf("Intn #%d = %d, want %d", i, got, w)
+		}
+	}
+	a, b := New(7), New(7)
+	if x, y := a.RandString(16, ""), b.RandString(16, ""); x != y {
+		t.Fatalf("RandString with same seed = %q, %q", x, y)
+	}
+	s1, s2 := []int{1, 2, 3, 4, 5, 6}, []int{1, 2, 3, 4, 5, 6}
+	ShuffleWith(a, s1)
+	ShuffleWith(b, s2)
+	for i := range s1 {
+		if s1[i] != s2[i] {
+			t.Fatalf("ShuffleWith with same seed = %v, %v", s1, s2)
+		}
+	}
+	if New(1).Int63() == New(2).Int63() {
+		t.Fatal("different seeds produced the same value")
+	}
+}
+
+func TestWeightedChoice(t *testing.T) {
+	r := New(3)
+	items := []string{"a", "b", "c", "d"}
+	counts := make(map[string]int)
+	const n = 10000
+	for i := 0; i < n; i++ {
+		item, ok := WeightedChoiceWith(r, items, []float64{70, 0, 30, -5})
+		if !ok {
+			t.Fatal("WeightedChoiceWith returned no item")
+		}
+		counts[item]++
+	}
+	// 权重为 0 或负数的元素不会被选中
+	if counts["b"] != 0 || counts["d"] != 0 {
+		t.Fatalf("zero or negative weight chosen: %v", counts)
+	}
+	if a := float64(counts["a"]) / n; a < 0.67 || a > 0.73 {
+		t.Fatalf("a chosen %.3f of the time, want about 0.7", a)
+	}
+}
+
+func TestWeightedChoiceEdges(t *testing.T) {
+	r := New(1)
+	tests := []struct {
+		name    string
+		items   []int
+		weights []float64
+		want    int
+		ok      bool
+	}{
+		{"no weights", []int{1, 2}, nil, 0, false},
+		{"all zero", []int{1, 2}, []float64{0, 0}, 0, false},
+		{"all negative", []int{1, 2}, []float64{-1, -2}, 0, false},
+		{"no items", nil, []float64{1}, 0, false},
+		// 多出的权重被忽略，缺少权重的元素不会被选中
+		{"extra weights", []int{1}, []float64{0, 5}, 0, false},
+		{"missing weights", []int{1, 2, 3}, []float64{0, 1}, 2, true},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got, ok := WeightedChoiceWith(r, tt.items, tt.weights)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("%s: WeightedChoiceWith = %d, %v, want %d, %v", tt.name, got, ok, tt.want, tt.ok)
+			}
+		}
+	}
+	if _, ok := WeightedChoice([]string{"x"}, []float64{1}); !ok {
+		t.Fatal("WeightedChoice with the default generator returned no item")
+	}
+}
@@ -0,0 +1,254 @@
+package goutil
+
+import (
+	"golang.org/x/text/width"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// StrPad 补全方向
+const (
+	StrPadLeft  = "left"
+	StrPadRight = "right"
+	StrPadBoth  = "both"
+)
+
+// clampRange 按 PHP substr 规则计算 [start, end) 区间，start、length 为负数时从末尾计算
+func clampRange(n, start int, length ...int) (int, int) {
+	if start < 0 {
+		start += n
+		if start < 0 {
+			start = 0
+		}
+	}
+	if start > n {
+		start = n
+	}
+	end := n
+	if len(length) > 0 {
+		l := length[0]
+		if l < 0 {
+			end = n + l
+		} else if start+l < n {
+			end = start + l
+		}
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+// MbSubstr 按字符截取子字符串，与 PHP mb_substr 一致：
+// start 为负数时从末尾倒数，省略 length 时截取到末尾，length 为负数时去掉末尾的字符，越界时返回空字符串
+func MbSubstr(str string, start int, length ...int) string {
+	r := []rune(str)
+	s, e := clampRange(len(r), start, length...)
+	return string(r[s:e])
+}
+
+// MbStrlen 字符数
+func MbStrlen(str string) int {
+	return utf8.RuneCountInString(str)
+}
+
+// runeWidth 字符显示宽度，东亚宽字符和全角字符为 2
+func runeWidth(r rune) int {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// MbStrwidth 显示宽度，与 PHP mb_strwidth 一致，中文等宽字符计为 2
+func MbStrwidth(str string) int {
+	w := 0
+	for _, r := range str {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// padding 用 padStr 循环填充 n 个字符
+func padding(padStr string, n int) string {
+	if n <= 0 || padStr == "" {
+		return ""
+	}
+	pad := []rune(padStr)
+	out := make([]rune, n)
+	for i := range out {
+		out[i] = pad[i%len(pad)]
+	}
+	return string(out)
+}
+
+// paddingWidth 用 padStr 循环填充到显示宽度 w，宽字符放不下时以空格补齐
+func paddingWidth(padStr string, w int) string {
+	if w <= 0 || padStr == "" {
+		return ""
+	}
+	pad := []rune(padStr)
+	var b strings.Builder
+	for i := 0; w > 0; i++ {
+		r := pad[i%len(pad)]
+		rw := runeWidth(r)
+		if rw > w {
+			r, rw = ' ', 1
+		}
+		b.WriteRune(r)
+		w -= rw
+	}
+	return b.String()
+}
+
+// splitPad 按补全方向拆分左右两侧的补全数量，both 时右侧多补
+func splitPad(diff int, padType string) (int, int) {
+	switch padType {
+	case StrPadLeft:
+		return diff, 0
+	case StrPadBoth, "center":
+		return diff / 2, diff - diff/2
+	}
+	return 0, diff
+}
+
+// StrPad 按字符数补全字符串到 padLen，padType 为 left、right、both（center）
+func StrPad(str string, padLen int, padStr, padType string) string {
+	diff := padLen - MbStrlen(str)
+	if diff <= 0 {
+		return str
+	}
+	left, right := splitPad(diff, padType)
+	return padding(padStr, left) + str + padding(padStr, right)
+}
+
+// StrPadWidth 按显示宽度补全字符串，用于对齐包含中文的文本
+func StrPadWidth(str string, padWidth int, padStr, padType string) string {
+	diff := padWidth - MbStrwidth(str)
+	if diff <= 0 {
+		return str
+	}
+	left, right := splitPad(diff, padType)
+	return paddingWidth(padStr, left) + str + paddingWidth(padStr, right)
+}
+
+// Truncate 超过 maxLen 个字符时截断并追加 ellipsis，结果总长度不超过 maxLen；
+// maxLen 小于等于 0 时返回空字符串，容纳不下 ellipsis 时返回截断后的 ellipsis
+func Truncate(str string, maxLen int, ellipsis string) string {
+	if maxLen <= 0 {
+		return ""
+	}
+	r := []rune(str)
+	if len(r) <= maxLen {
+		return str
+	}
+	keep := maxLen - MbStrlen(ellipsis)
+	if keep <= 0 {
+		return MbSubstr(ellipsis, 0, maxLen)
+	}
+	return string(r[:keep]) + ellipsis
+}
+
+// TruncateWidth 超过显示宽度时截断并追加 ellipsis，与 PHP mb_strimwidth 一致；
+// maxWidth 小于等于 0 时返回空字符串，容纳不下 ellipsis 时返回按宽度截断后的 ellipsis
+func TruncateWidth(str string, maxWidth int, ellipsis string) string {
+	if maxWidth <= 0 {
+		return ""
+	}
+	if MbStrwidth(str) <= maxWidth {
+		return str
+	}
+	keep := maxWidth - MbStrwidth(ellipsis)
+	if keep <= 0 {
+		return truncateRunesWidth(ellipsis, maxWidth)
+	}
+	return truncateRunesWidth(str, keep) + ellipsis
+}
+
+// truncateRunesWidth 保留显示宽度不超过 width 的前缀
+func truncateRunesWidth(str string, width int) string {
+	var b strings.Builder
+	for _, r := range str {
+		rw := runeWidth(r)
+		if rw > width {
+			break
+		}
+		b.WriteRune(r)
+		width -= rw
+	}
+	return b.String()
+}
+
+// Ucfirst 首字母大写
+func Ucfirst(str string) string {
+	r, size := utf8.DecodeRuneInString(str)
+	if size == 0 {
+		return str
+	}
+	return string(unicode.ToUpper(r)) + str[size:]
+}
+
+// Lcfirst 首字母小写
+func Lcfirst(str string) string {
+	r, size := utf8.DecodeRuneInString(str)
+	if size == 0 {
+		return str
+	}
+	return string(unicode.ToLower(r)) + str[size:]
+}
+
+// splitWords 按下划线、中划线、空格及大小写边界拆分单词，连续大写视为缩写，如 HTTPServer 拆为 HTTP、Server
+func splitWords(str string) []string {
+	var (
+		words []string
+		cur   []rune
+	)
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, string(cur))
+			cur = cur[:0]
+		}
+	}
+	r := []rune(str)
+	for i, c := range r {
+		switch {
+		case c == '_' || c == '-' || unicode.IsSpace(c):
+			flush()
+			continue
+		case unicode.IsUpper(c) && len(cur) > 0:
+			prev := r[i-1]
+			nextLower := i+1 < len(r) && unicode.IsLower(r[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		cur = append(cur, c)
+	}
+	flush()
+	return words
+}
+
+// CamelCase 转为大驼峰，如 user_id -> UserId
+func CamelCase(str string) string {
+	var b strings.Builder
+	for _, w := range splitWords(str) {
+		b.WriteString(Ucfirst(strings.ToLower(w)))
+	}
+	return b.String()
+}
+
+// LowerCamelCase 转为小驼峰，如 user_id -> userId
+func LowerCamelCase(str string) string {
+	return Lcfirst(CamelCase(str))
+}
+
+// SnakeCase 转为下划线命名，如 UserID -> user_id，HTTPServer -> http_server
+func SnakeCase(str string) string {
+	words := splitWords(str)
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return strings.Join(words, "_")
+}
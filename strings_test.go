@@ -0,0 +1,161 @@
+package goutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMbSubstr(t *testing.T) {
+	const s = "héllo世界"
+	tests := []struct {
+		start  int
+		length []int
+		want   string
+	}{
+		{0, nil, s},
+		{1, []int{3}, "éll"},
+		{-2, nil, "世界"},
+		{-2, []int{1}, "世"},
+		{1, []int{-2}, "éllo"},
+		{3, []int{100}, "lo世界"},
+		{-10, []int{2}, "hé"},
+		{10, nil, ""},
+		{2, []int{-10}, ""},
+		{0, []int{0}, ""},
+	}
+	for _, tt := range tests {
+		if got := MbSubstr(s, tt.start, tt.length...); got != tt.want {
+			t.Errorf("MbSubstr(%q, %d, %v) = %q, want %q", s, tt.start, tt.length, got, tt.want)
+		}
+	}
+	if got := MbSubstr("", -1, 1); got != "" {
+		t.Errorf("MbSubstr of empty string = %q", got)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		str, ellipsis string
+		maxLen        int
+		want          string
+	}{
+		{"hello", "...", 10, "hello"},
+		{"hello world", "...", 8, "hello..."},
+		{"中文测试", "…", 3, "中文…"},
+		{"hello", "...", 2, ".."},
+		{"hello", "...", 0, ""},
+		{"hello", "", -1, ""},
+	}
+	for _, tt := range tests {
+		if got := Truncate(tt.str, tt.maxLen, tt.ellipsis); got != tt.want {
+			t.Errorf("Truncate(%q, %d, %q) = %q, want %q", tt.str, tt.maxLen, tt.ellipsis, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateWidth(t *testing.T) {
+	tests := []struct {
+		str, ellipsis string
+		maxWidth      int
+		want          string
+	}{
+		{"hello", "...", 10, "hello"},
+		{"hello world", "...", 8, "hello..."},
+		{"你好世界", "...", 8, "你好世界"},
+		// 宽字符放不下时不截断半个字符
+		{"你好世界", "...", 6, "你..."},
+		{"ab你好", "…", 4, "ab…"},
+		{"hello", "...", 2, ".."},
+		{"hello", "...", 0, ""},
+		{"hello", "", -1, ""},
+	}
+	for _, tt := range tests {
+		if got := TruncateWidth(tt.str, tt.maxWidth, tt.ellipsis); got != tt.want {
+			t.Errorf("TruncateWidth(%q, %d, %q) = %q, want %q", tt.str, tt.maxWidth, tt.ellipsis, got, tt.want)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := map[string]string{
+		"HTTPServer":          "HTTP|Server",
+		"getHTTPResponseCode": "get|HTTP|Response|Code",
+		"UserID":              "User|ID",
+		"version2Update":      "version2|Update",
+		"  foo-bar baz_qux ":  "foo|bar|baz|qux",
+		"":                    "",
+	}
+	for in, want := range tests {
+		if got := strings.Join(splitWords(in), "|"); got != want {
+			t.Errorf("splitWords(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCaseConversion(t *testing.T) {
+	tests := []struct {
+		in, snake, camel, lowerCamel string
+	}{
+		{"HTTPServer", "http_server", "HttpServer", "httpServer"},
+		{"UserID", "user_id", "UserId", "userId"},
+		{"user_id", "user_id", "UserId", "userId"},
+		{"userId", "user_id", "UserId", "userId"},
+		{"ID", "id", "Id", "id"},
+		{"", "", "", ""},
+	}
+	for _, tt := range tests {
+		if got := SnakeCase(tt.in); got != tt.snake {
+			t.Errorf("SnakeCase(%q) = %q, want %q", tt.in, got, tt.snake)
+		}
+		if got := CamelCase(tt.in); got != tt.camel {
+			t.Errorf("CamelCase(%q) = %q, want %q", tt.in, got, tt.camel)
+		}
+		if got := LowerCamelCase(tt.in); got != tt.lowerCamel {
+			t.Errorf("LowerCamelCase(%q) = %q, want %q", tt.in, got, tt.lowerCamel)
+		}
+	}
+}
+
+func TestStrPad(t *testing.T) {
+	tests := []struct {
+		str     string
+		padLen  int
+		padStr  string
+		padType string
+		want    string
+	}{
+		{"5", 3, "0", StrPadLeft, "005"},
+		{"ab", 5, "xy", StrPadRight, "abxyx"},
+		{"ab", 5, "*", StrPadBoth, "*ab**"},
+		{"ab", 6, "*", "center", "**ab**"},
+		{"中文", 4, "-", StrPadLeft, "--中文"},
+		{"hello", 3, "*", StrPadLeft, "hello"},
+		{"ab", 5, "", StrPadLeft, "ab"},
+		{"ab", 4, "*", "unknown", "ab**"},
+	}
+	for _, tt := range tests {
+		if got := StrPad(tt.str, tt.padLen, tt.padStr, tt.padType); got != tt.want {
+			t.Errorf("StrPad(%q, %d, %q, %q) = %q, want %q", tt.str, tt.padLen, tt.padStr, tt.padType, got, tt.want)
+		}
+	}
+}
+
+func TestStrPadWidth(t *testing.T) {
+	tests := []struct {
+		str      string
+		padWidth int
+		padStr   string
+		padType  string
+		want     string
+	}{
+		{"中文", 6, "-", StrPadRight, "中文--"},
+		{"中文", 3, "-", StrPadRight, "中文"},
+		// 宽字符放不下时以空格补齐
+		{"a", 4, "中", StrPadLeft, "中 a"},
+	}
+	for _, tt := range tests {
+		if got := StrPadWidth(tt.str, tt.padWidth, tt.padStr, tt.padType); got != tt.want {
+			t.Errorf("StrPadWidth(%q, %d, %q, %q) = %q, want %q", tt.str, tt.padWidth, tt.padStr, tt.padType, got, tt.want)
+		}
+	}
+}